@@ -0,0 +1,205 @@
+// Package admin defines the control API a running devlink server exposes on
+// a Unix socket in its state directory, and a client for it.
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"local-ssl/internal/certs"
+)
+
+// SocketName is the file name of the control socket in the state directory.
+const SocketName = "devlink.sock"
+
+// ErrNotRunning is returned by Connect when no server answers on the
+// control socket.
+var ErrNotRunning = errors.New("devlink server is not running")
+
+// SocketPath returns the control socket path for a state directory.
+func SocketPath(stateDir string) string {
+	return filepath.Join(stateDir, SocketName)
+}
+
+// Status describes a running server.
+type Status struct {
+	PID          int       `json:"pid"`
+	StartedAt    time.Time `json:"startedAt"`
+	ConfigPath   string    `json:"configPath"`
+	StateDir     string    `json:"stateDir"`
+	HTTPPort     int       `json:"httpPort"`
+	HTTPSPort    int       `json:"httpsPort"`
+	InspectorURL string    `json:"inspectorUrl,omitempty"`
+	MetricsAddr  string    `json:"metricsAddr,omitempty"`
+	Projects     []string  `json:"projects"`
+	Drained      []string  `json:"drained,omitempty"`
+	LastReload   Reload    `json:"lastReload"`
+}
+
+// Reload reports the outcome of the most recent configuration reload. When
+// it failed, the server keeps serving the last configuration that loaded.
+type Reload struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Route is an entry of the routing table.
+type Route struct {
+	Project   string   `json:"project"`
+	Domains   []string `json:"domains"`
+	Path      string   `json:"path"`
+	Kind      string   `json:"kind"`
+	Upstreams []string `json:"upstreams,omitempty"`
+	Enabled   bool     `json:"enabled"`
+	Draining  bool     `json:"draining,omitempty"`
+	// StripPrefix, Websocket and SpaFallback echo the route's settings.
+	StripPrefix bool `json:"stripPrefix"`
+	Websocket   bool `json:"websocket"`
+	SpaFallback bool `json:"spaFallback"`
+	// RetryTimeout and HealthTimeout are set when the route configures
+	// retries or health checks with a timeout.
+	RetryTimeout  string `json:"retryTimeout,omitempty"`
+	HealthTimeout string `json:"healthTimeout,omitempty"`
+	// Source is the configuration or project file defining the project.
+	Source string `json:"source,omitempty"`
+}
+
+// UpstreamStatus reports the health of a single upstream target.
+type UpstreamStatus struct {
+	Project  string `json:"project"`
+	Route    string `json:"route"`
+	Upstream string `json:"upstream"`
+	Healthy  bool   `json:"healthy"`
+	Active   int64  `json:"active"`
+}
+
+// DrainRequest stops or resumes traffic to a project. Draining answers new
+// requests with 503 while requests in flight complete.
+type DrainRequest struct {
+	Project string `json:"project"`
+	Drain   bool   `json:"drain"`
+}
+
+// RouteToggle enables or disables a route. Requests for a disabled route
+// fall through to the next matching route of the project.
+type RouteToggle struct {
+	Project string `json:"project"`
+	Route   string `json:"route"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Error is the body of failed API calls.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Client talks to the control API of a running server.
+type Client struct {
+	http *http.Client
+}
+
+// Connect returns a client for the server owning stateDir, or ErrNotRunning
+// when none is listening.
+func Connect(stateDir string) (*Client, error) {
+	path := SocketPath(stateDir)
+	if _, err := os.Stat(path); err != nil {
+		return nil, ErrNotRunning
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	conn.Close()
+	dialer := &net.Dialer{Timeout: time.Second}
+	return &Client{http: &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}}, nil
+}
+
+// Status returns the state of the server.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	return &status, c.do(ctx, http.MethodGet, "/v1/status", nil, &status)
+}
+
+// Routes returns the routing table, ordered by project and path.
+func (c *Client) Routes(ctx context.Context) ([]Route, error) {
+	var routes []Route
+	return routes, c.do(ctx, http.MethodGet, "/v1/routes", nil, &routes)
+}
+
+// Health returns the health of every upstream target.
+func (c *Client) Health(ctx context.Context) ([]UpstreamStatus, error) {
+	var health []UpstreamStatus
+	return health, c.do(ctx, http.MethodGet, "/v1/health", nil, &health)
+}
+
+// Certificates describes the certificates the server uses.
+func (c *Client) Certificates(ctx context.Context) ([]certs.CertificateInfo, error) {
+	var infos []certs.CertificateInfo
+	return infos, c.do(ctx, http.MethodGet, "/v1/certs", nil, &infos)
+}
+
+// Reload makes the server reload its configuration and returns the result.
+func (c *Client) Reload(ctx context.Context) (*Reload, error) {
+	var reload Reload
+	return &reload, c.do(ctx, http.MethodPost, "/v1/reload", nil, &reload)
+}
+
+// Drain stops or resumes traffic to a project.
+func (c *Client) Drain(ctx context.Context, project string, drain bool) error {
+	return c.do(ctx, http.MethodPost, "/v1/drain", DrainRequest{Project: project, Drain: drain}, nil)
+}
+
+// SetRouteEnabled enables or disables a route.
+func (c *Client) SetRouteEnabled(ctx context.Context, project, route string, enabled bool) error {
+	return c.do(ctx, http.MethodPost, "/v1/routes/toggle", RouteToggle{Project: project, Route: route, Enabled: enabled}, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://devlink"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("control API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr Error
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("control API: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
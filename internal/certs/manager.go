@@ -57,6 +57,53 @@ func (m *Manager) EnsureCertificate() (*tls.Certificate, error) {
 	return &cert, nil
 }
 
+// CertificateInfo describes a certificate kept by the Manager.
+type CertificateInfo struct {
+	// Name is "ca" for the root CA and "localhost" for the server
+	// certificate.
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Subject   string    `json:"subject"`
+	DNSNames  []string  `json:"dnsNames,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// Certificates describes the CA and server certificates on disk.
+// Certificates that have not been created yet are skipped.
+func (m *Manager) Certificates() ([]CertificateInfo, error) {
+	var infos []CertificateInfo
+	for _, c := range []struct{ name, path string }{
+		{"ca", m.caCertPath()},
+		{"localhost", m.serverCertPath()},
+	} {
+		data, err := os.ReadFile(c.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s certificate: %w", c.name, err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid %s certificate encoding", c.name)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s certificate: %w", c.name, err)
+		}
+		infos = append(infos, CertificateInfo{
+			Name:      c.name,
+			Path:      c.path,
+			Subject:   cert.Subject.CommonName,
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+	return infos, nil
+}
+
 func (m *Manager) ensureCA() error {
 	certPath := m.caCertPath()
 	keyPath := m.caKeyPath()
@@ -192,6 +239,35 @@ func (m *Manager) loadCA() (*x509.Certificate, *rsa.PrivateKey, error) {
 	return cert, key, nil
 }
 
+// CAPath returns the path of the root CA certificate users install into
+// their trust stores.
+func (m *Manager) CAPath() string {
+	return m.caCertPath()
+}
+
+// VerifySystemTrust checks that the server certificate chains to a root
+// trusted by the operating system store.
+func (m *Manager) VerifySystemTrust() error {
+	data, err := os.ReadFile(m.serverCertPath())
+	if err != nil {
+		return fmt.Errorf("read server certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("invalid server certificate encoding")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse server certificate: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return fmt.Errorf("load system roots: %w", err)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "devlink.localhost"})
+	return err
+}
+
 func (m *Manager) caCertPath() string {
 	return filepath.Join(m.dir, caCertFile)
 }
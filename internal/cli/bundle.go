@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/config"
+)
+
+func newExportCommand(configPath *string) *cobra.Command {
+	var params bool
+	var file string
+	cmd := &cobra.Command{
+		Use:   "export <project>",
+		Short: "Write a project as a portable bundle",
+		Long: "Writes the project as it is stored, keeping ${VAR} references, so that others can add it with devlink import.\n" +
+			"With --params, the ports of loopback upstreams become parameters that import can override.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			proj, err := rawProject(resolveConfigPath(configPath), name)
+			if err != nil {
+				return err
+			}
+			bundle, err := config.NewBundle(name, proj, params)
+			if err != nil {
+				return err
+			}
+			data, err := bundle.Marshal()
+			if err != nil {
+				return err
+			}
+			if file == "" || file == "-" {
+				_, err := cmd.OutOrStdout().Write(data)
+				return err
+			}
+			if err := os.WriteFile(file, data, 0o644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "project %s exported to %s\n", name, file)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&params, "params", false, "turn the ports of loopback upstreams into parameters")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "write the bundle to this file instead of stdout")
+	return cmd
+}
+
+// rawProject returns a project as stored in the file defining it, before
+// interpolation.
+func rawProject(path, name string) (*config.Project, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	proj, ok := cfg.Projects[name]
+	if !ok {
+		return nil, fmt.Errorf("project %s not found", name)
+	}
+	data, err := os.ReadFile(proj.Source)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := config.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", proj.Source, err)
+	}
+	return raw.Projects[name], nil
+}
+
+func newImportCommand(configPath *string) *cobra.Command {
+	var name string
+	var domains []string
+	var set []string
+	var replace bool
+	cmd := &cobra.Command{
+		Use:   "import <file|->",
+		Short: "Add a project from a bundle",
+		Long: "Adds the project of a bundle written by devlink export. Parameters take their defaults unless given with --set.\n" +
+			"Relative paths in the bundle are resolved against the directory of the configuration file.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseParams(set)
+			if err != nil {
+				return err
+			}
+			var data []byte
+			if args[0] == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return err
+			}
+			bundle, err := config.ParseBundle(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			proj, err := bundle.Expand(values)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				name = bundle.Name
+			}
+			if name == "" {
+				return errors.New("the bundle has no name; pass --name")
+			}
+			if len(domains) > 0 {
+				proj.Domains = domains
+			}
+			if len(proj.Domains) == 0 {
+				return errors.New("the bundle has no domains; pass --domain")
+			}
+			path := resolveConfigPath(configPath)
+			err = config.Edit(path, func(cfg *config.Config) error {
+				if source := includedSource(path, cfg, name); source != "" {
+					return fmt.Errorf("project %s is defined in %s; import it under another --name", name, source)
+				}
+				return config.ImportProject(cfg, name, proj, replace)
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "project %s imported\n", name)
+			return reloadServer(cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "project name (defaults to the bundle's)")
+	cmd.Flags().StringSliceVar(&domains, "domain", nil, "domain(s) replacing the bundle's")
+	cmd.Flags().StringArrayVar(&set, "set", nil, "parameter value in form NAME=value (repeatable)")
+	cmd.Flags().BoolVar(&replace, "replace", false, "overwrite a project with the same name")
+	return cmd
+}
+
+// parseParams reads NAME=value pairs given with --set.
+func parseParams(values []string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --set %q (want NAME=value)", v)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+func newTemplatesCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "templates",
+		Short: "List the project templates of devlink add --template",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			templates, err := config.Templates()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TEMPLATE\tDESCRIPTION\tPARAMETERS")
+			for _, t := range templates {
+				params := make([]string, 0, len(t.Params))
+				for _, p := range t.Params {
+					params = append(params, p.Name+"="+p.Default)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, t.Description, strings.Join(params, " "))
+			}
+			return w.Flush()
+		},
+	}
+}
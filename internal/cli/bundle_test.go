@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const exportConfig = `projects:
+  shop:
+    domains: [shop.localhost]
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:${FRONT_PORT:-5173}
+      - path: /api
+        upstream: http://localhost:8080
+      - path: /static
+        root: public
+`
+
+func TestExportImport(t *testing.T) {
+	path := writeConfig(t, exportConfig)
+
+	out := mustRun(t, path, "export", "shop", "--params")
+	for _, want := range []string{"name: shop\n", "name: API_PORT\n", "http://localhost:${API_PORT}", "${FRONT_PORT:-5173}", "root: public\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the bundle to contain %q:\n%s", want, out)
+		}
+	}
+
+	bundle := filepath.Join(t.TempDir(), "shop.yaml")
+	if out := mustRun(t, path, "export", "shop", "--params", "-f", bundle); out != "project shop exported to "+bundle+"\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	if _, err := runCLI(t, path, "import", bundle); err == nil || !strings.Contains(err.Error(), "project shop already exists") {
+		t.Fatalf("expected importing over an existing project to fail, got %v", err)
+	}
+	out = mustRun(t, path, "import", bundle, "--name", "shop2", "--domain", "shop2.localhost", "--set", "API_PORT=9090")
+	if out != "project shop2 imported\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	proj := loadConfig(t, path).Projects["shop2"]
+	if proj == nil || len(proj.Domains) != 1 || proj.Domains[0] != "shop2.localhost" {
+		t.Fatalf("unexpected imported project: %+v", proj)
+	}
+	if got := proj.Routes[1].Upstream; got != "http://localhost:9090" {
+		t.Fatalf("expected the --set port in the upstream, got %s", got)
+	}
+	if got := proj.Routes[2].Root; got != "public" {
+		t.Fatalf("expected the relative root to stay relative, got %s", got)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "${FRONT_PORT:-5173}") {
+		t.Fatalf("expected the variable reference to be kept:\n%s", data)
+	}
+}
+
+func TestImportFromStdinRejectsDuplicateDomains(t *testing.T) {
+	path := writeConfig(t, exportConfig)
+	bundle := mustRun(t, path, "export", "shop")
+
+	root := newRootCommand()
+	var out strings.Builder
+	root.SetArgs([]string{"--config", path, "import", "-", "--name", "copy"})
+	root.SetIn(strings.NewReader(bundle))
+	root.SetOut(&out)
+	root.SetErr(&out)
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "domain shop.localhost is already used by project shop") {
+		t.Fatalf("expected the duplicate domain to be refused, got %v", err)
+	}
+	if loadConfig(t, path).Projects["copy"] != nil {
+		t.Fatal("expected the refused project not to be saved")
+	}
+}
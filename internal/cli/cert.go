@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/certs"
+	"local-ssl/internal/util"
+)
+
+func newCertCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:     "cert",
+		Aliases: []string{"certs"},
+		Short:   "List the devlink CA and server certificates",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkOutputFormat(output); err != nil {
+				return err
+			}
+			mgr, err := certs.NewManager(util.StateDir())
+			if err != nil {
+				return err
+			}
+			infos, err := mgr.Certificates()
+			if err != nil {
+				return err
+			}
+			if infos == nil {
+				infos = []certs.CertificateInfo{}
+			}
+
+			out := cmd.OutOrStdout()
+			if output != outputTable {
+				return writeStructured(out, output, infos)
+			}
+			if len(infos) == 0 {
+				fmt.Fprintln(out, "no certificates yet; run devlink serve once to create them")
+				return nil
+			}
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSUBJECT\tDNS NAMES\tEXPIRES\tDAYS LEFT\tPATH")
+			for _, c := range infos {
+				names := strings.Join(c.DNSNames, ", ")
+				if names == "" {
+					names = "-"
+				}
+				days := int(time.Until(c.NotAfter).Hours() / 24)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", c.Name, c.Subject, names, c.NotAfter.Format("2006-01-02"), days, c.Path)
+			}
+			return w.Flush()
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
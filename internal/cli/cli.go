@@ -5,21 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"local-ssl/internal/config"
+	"local-ssl/internal/har"
+	"local-ssl/internal/ports"
 	"local-ssl/internal/server"
+	"local-ssl/internal/supervisor"
 	"local-ssl/internal/util"
 )
 
 // Execute runs the CLI.
 func Execute() error {
+	return newRootCommand().Execute()
+}
+
+func newRootCommand() *cobra.Command {
 	root := &cobra.Command{
 		Use:   "devlink",
 		Short: "Devlink .localhost development proxy",
@@ -29,11 +40,25 @@ func Execute() error {
 	root.PersistentFlags().StringVar(&configPath, "config", "", "path to configuration file")
 
 	root.AddCommand(newServeCommand(&configPath))
+	root.AddCommand(newUpCommand(&configPath))
+	root.AddCommand(newRecordCommand(&configPath))
+	root.AddCommand(newReplayCommand())
 	root.AddCommand(newAddCommand(&configPath))
 	root.AddCommand(newListCommand(&configPath))
 	root.AddCommand(newRemoveCommand(&configPath))
-
-	return root.Execute()
+	root.AddCommand(newLinkCommand(&configPath))
+	root.AddCommand(newUnlinkCommand(&configPath))
+	root.AddCommand(newConfigCommand(&configPath))
+	root.AddCommand(newExportCommand(&configPath))
+	root.AddCommand(newImportCommand(&configPath))
+	root.AddCommand(newTemplatesCommand())
+	root.AddCommand(newReloadCommand())
+	root.AddCommand(newStatusCommand())
+	root.AddCommand(newCertCommand())
+	root.AddCommand(newDoctorCommand(&configPath))
+	root.AddCommand(newDrainCommand())
+	root.AddCommand(newRouteCommand(&configPath))
+	return root
 }
 
 func resolveConfigPath(flag *string) string {
@@ -48,45 +73,213 @@ func resolveConfigPath(flag *string) string {
 }
 
 func newServeCommand(configPath *string) *cobra.Command {
-	var httpPort int
-	var httpsPort int
+	proxy := &serverFlags{}
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the HTTPS reverse proxy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			srv, err := newServer(resolveConfigPath(configPath), proxy.options())
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signalContext()
+			defer cancel()
+
+			log.Println("devlink proxy starting")
+			return srv.Run(ctx)
+		},
+	}
+	proxy.register(cmd)
+	return cmd
+}
+
+// serverFlags holds the proxy settings shared by serve, up and record.
+type serverFlags struct {
+	httpPort    int
+	httpsPort   int
+	noInspector bool
+	metricsAddr string
+}
+
+func (f *serverFlags) register(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&f.httpPort, "http-port", 80, "port for HTTP->HTTPS redirect")
+	cmd.Flags().IntVar(&f.httpsPort, "https-port", 443, "port for HTTPS proxy")
+	cmd.Flags().BoolVar(&f.noInspector, "no-inspector", false, "disable the traffic inspector at "+server.InspectorHost)
+	cmd.Flags().StringVar(&f.metricsAddr, "metrics", "", "serve Prometheus metrics at /metrics on this loopback address (e.g. 127.0.0.1:9090)")
+}
+
+// options returns the server options the flags select.
+func (f *serverFlags) options() server.Options {
+	return server.Options{
+		HTTPPort:         f.httpPort,
+		HTTPSPort:        f.httpsPort,
+		DisableInspector: f.noInspector,
+		MetricsAddr:      f.metricsAddr,
+	}
+}
+
+// newServer creates the proxy server for the configuration at path,
+// initializing an empty configuration file when none exists.
+func newServer(path string, opts server.Options) (*server.Server, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := config.Save(path, config.New()); err != nil {
+			return nil, fmt.Errorf("initialize config: %w", err)
+		}
+	}
+	opts.ConfigPath = path
+	opts.StateDir = util.StateDir()
+	return server.New(opts)
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigCh)
+	}()
+	return ctx, cancel
+}
+
+func newUpCommand(configPath *string) *cobra.Command {
+	proxy := &serverFlags{}
+	var noProxy bool
+	cmd := &cobra.Command{
+		Use:   "up <project>...",
+		Short: "Start project dev servers under supervision together with the proxy",
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			path := resolveConfigPath(configPath)
-			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
-				if err := config.Save(path, config.New()); err != nil {
-					return fmt.Errorf("initialize config: %w", err)
-				}
+			cfg, err := config.Load(path)
+			if err != nil {
+				return err
 			}
-			opts := server.Options{
-				ConfigPath: path,
-				StateDir:   util.StateDir(),
-				HTTPPort:   httpPort,
-				HTTPSPort:  httpsPort,
+			store := ports.Open(util.StateDir())
+			defer store.Release(args...)
+			cfg, err = ports.Apply(cfg, store, args...)
+			if err != nil {
+				return err
 			}
-			srv, err := server.New(opts)
+			specs, err := supervisor.FromConfig(cfg, filepath.Dir(path), args)
 			if err != nil {
 				return err
 			}
-			ctx, cancel := context.WithCancel(context.Background())
+			if len(specs) == 0 {
+				return fmt.Errorf("no route commands configured for %s", strings.Join(args, ", "))
+			}
+			sup := supervisor.New(specs, cmd.OutOrStdout())
+
+			ctx, cancel := signalContext()
 			defer cancel()
-			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-			defer signal.Stop(sigCh)
+			if noProxy {
+				return sup.Run(ctx)
+			}
 
+			opts := proxy.options()
+			opts.Readiness = sup.Ready
+			srv, err := newServer(path, opts)
+			if err != nil {
+				return err
+			}
+			supDone := make(chan struct{})
 			go func() {
-				<-sigCh
-				cancel()
+				defer close(supDone)
+				_ = sup.Run(ctx)
 			}()
+			log.Println("devlink proxy starting")
+			err = srv.Run(ctx)
+			cancel()
+			<-supDone
+			return err
+		},
+	}
+	proxy.register(cmd)
+	cmd.Flags().BoolVar(&noProxy, "no-proxy", false, "only run the processes, for use with a separately running devlink serve")
+	return cmd
+}
+
+func newRecordCommand(configPath *string) *cobra.Command {
+	proxy := &serverFlags{}
+	record := &server.RecordOptions{}
+	cmd := &cobra.Command{
+		Use:   "record <project>...",
+		Short: "Run the proxy and record upstream traffic of projects into a HAR file",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := resolveConfigPath(configPath)
+			cfg, err := config.Load(path)
+			if err != nil {
+				return err
+			}
+			for _, name := range args {
+				if _, ok := cfg.Projects[name]; !ok {
+					return fmt.Errorf("project %s not found", name)
+				}
+			}
+			record.Projects = args
+			if record.Path == "" {
+				record.Path = fmt.Sprintf("devlink-%s.har", time.Now().Format("20060102-150405"))
+			}
+			opts := proxy.options()
+			opts.Record = record
+			srv, err := newServer(path, opts)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := signalContext()
+			defer cancel()
 
 			log.Println("devlink proxy starting")
-			return srv.Run(ctx)
+			if err := srv.Run(ctx); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "recording saved to %s\n", record.Path)
+			return nil
 		},
 	}
-	cmd.Flags().IntVar(&httpPort, "http-port", 80, "port for HTTP->HTTPS redirect")
-	cmd.Flags().IntVar(&httpsPort, "https-port", 443, "port for HTTPS proxy")
+	cmd.Flags().StringVarP(&record.Path, "output", "o", "", "HAR file to write (default devlink-<timestamp>.har)")
+	cmd.Flags().Int64Var(&record.MaxBodyBytes, "max-body", 1<<20, "maximum bytes of each request and response body to record")
+	cmd.Flags().StringSliceVar(&record.RedactHeaders, "redact", server.DefaultRedactedHeaders, "headers whose values are masked in the recording")
+	proxy.register(cmd)
+	return cmd
+}
+
+func newReplayCommand() *cobra.Command {
+	var listen string
+	cmd := &cobra.Command{
+		Use:   "replay <har>",
+		Short: "Serve the responses recorded in a HAR file as an HTTP upstream",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			archive, err := har.Load(args[0])
+			if err != nil {
+				return err
+			}
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+			srv := &http.Server{Handler: har.NewReplayer(archive)}
+			ctx, cancel := signalContext()
+			defer cancel()
+			go func() {
+				<-ctx.Done()
+				srv.Close()
+			}()
+			fmt.Fprintf(cmd.OutOrStdout(), "replaying %d recorded response(s) on http://%s\n", len(archive.Log.Entries), ln.Addr())
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:0", "address to serve the recordings on")
 	return cmd
 }
 
@@ -96,6 +289,8 @@ type addOptions struct {
 	backend       string
 	backendPrefix string
 	routes        []string
+	template      string
+	params        []string
 }
 
 func newAddCommand(configPath *string) *cobra.Command {
@@ -109,22 +304,24 @@ func newAddCommand(configPath *string) *cobra.Command {
 			if name == "" {
 				return errors.New("project name required")
 			}
-			path := resolveConfigPath(configPath)
-			cfg, err := config.Load(path)
-			if err != nil {
-				return err
-			}
-			proj := &config.Project{}
-			if existing, ok := cfg.Projects[name]; ok {
-				proj = existing
-			}
-			if len(opts.domains) > 0 {
-				proj.Domains = opts.domains
-			}
-			if len(proj.Domains) == 0 {
-				return errors.New("at least one --domain is required")
-			}
 			routes := []*config.Route{}
+			if opts.template != "" {
+				tmpl, err := config.Template(opts.template)
+				if err != nil {
+					return err
+				}
+				values, err := parseParams(opts.params)
+				if err != nil {
+					return err
+				}
+				proj, err := tmpl.Expand(values)
+				if err != nil {
+					return fmt.Errorf("template %s: %w", opts.template, err)
+				}
+				routes = append(routes, proj.Routes...)
+			} else if len(opts.params) > 0 {
+				return errors.New("--set requires --template")
+			}
 			if opts.front != "" {
 				routes = append(routes, &config.Route{
 					Path:        "/",
@@ -145,35 +342,50 @@ func newAddCommand(configPath *string) *cobra.Command {
 				})
 			}
 			for _, raw := range opts.routes {
-				route, err := parseRouteFlag(raw)
+				route, err := parseRouteFlag(raw, filepath.Dir(resolveConfigPath(configPath)))
 				if err != nil {
 					return err
 				}
 				routes = append(routes, route)
 			}
-			if len(routes) > 0 {
-				proj.Routes = routes
-			}
-			if err := validateProject(proj); err != nil {
-				return err
-			}
-			cfg.Projects[name] = proj
-			if err := config.Save(path, cfg); err != nil {
+			path := resolveConfigPath(configPath)
+			err := config.Edit(path, func(cfg *config.Config) error {
+				proj := &config.Project{}
+				if existing, ok := cfg.Projects[name]; ok {
+					proj = existing
+				} else if source := includedSource(path, cfg, name); source != "" {
+					return fmt.Errorf("project %s is defined in %s; edit that file instead", name, source)
+				}
+				if len(opts.domains) > 0 {
+					proj.Domains = opts.domains
+				}
+				if len(proj.Domains) == 0 {
+					return errors.New("at least one --domain is required")
+				}
+				if len(routes) > 0 {
+					proj.Routes = routes
+				}
+				cfg.Projects[name] = proj
+				return nil
+			})
+			if err != nil {
 				return err
 			}
 			fmt.Fprintf(cmd.OutOrStdout(), "project %s saved\n", name)
-			return nil
+			return reloadServer(cmd.OutOrStdout())
 		},
 	}
 	cmd.Flags().StringSliceVar(&opts.domains, "domain", nil, "domain(s) for the project (must end with .localhost)")
 	cmd.Flags().StringVar(&opts.front, "front", "", "frontend upstream URL")
 	cmd.Flags().StringVar(&opts.backend, "backend", "", "backend upstream URL")
 	cmd.Flags().StringVar(&opts.backendPrefix, "backend-prefix", "/api", "default backend route prefix")
-	cmd.Flags().StringArrayVar(&opts.routes, "route", nil, "additional route in form <path>=<upstream>")
+	cmd.Flags().StringArrayVar(&opts.routes, "route", nil, "additional route in form <path>=<upstream>[,<upstream>...] or <path>=<directory>")
+	cmd.Flags().StringVar(&opts.template, "template", "", "start from a built-in template (see devlink templates)")
+	cmd.Flags().StringArrayVar(&opts.params, "set", nil, "template parameter in form NAME=value (repeatable)")
 	return cmd
 }
 
-func parseRouteFlag(value string) (*config.Route, error) {
+func parseRouteFlag(value, baseDir string) (*config.Route, error) {
 	segments := strings.Split(value, ";")
 	if len(segments) == 0 {
 		return nil, errors.New("empty route value")
@@ -183,20 +395,59 @@ func parseRouteFlag(value string) (*config.Route, error) {
 		return nil, fmt.Errorf("invalid route %q", value)
 	}
 	path := strings.TrimSpace(parts[0])
-	upstream := strings.TrimSpace(parts[1])
 	if !strings.HasPrefix(path, "/") {
 		return nil, fmt.Errorf("route path must start with '/' (got %s)", path)
 	}
-	if _, err := url.Parse(upstream); err != nil {
-		return nil, fmt.Errorf("invalid upstream %s: %w", upstream, err)
-	}
 	strip := true
-	route := &config.Route{Path: path, Upstream: upstream, StripPathPrefix: &strip}
+	route := &config.Route{Path: path, StripPathPrefix: &strip}
+	target := strings.TrimSpace(parts[1])
+	if strings.HasPrefix(target, ".") || strings.HasPrefix(target, "/") || filepath.IsAbs(target) {
+		root, err := configRelative(baseDir, target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root %s: %w", target, err)
+		}
+		route.Root = root
+	} else {
+		for _, upstream := range strings.Split(target, ",") {
+			upstream = strings.TrimSpace(upstream)
+			if upstream == "" {
+				continue
+			}
+			if _, err := url.Parse(upstream); err != nil {
+				return nil, fmt.Errorf("invalid upstream %s: %w", upstream, err)
+			}
+			if route.Upstream == "" {
+				route.Upstream = upstream
+			} else {
+				route.Upstreams = append(route.Upstreams, upstream)
+			}
+		}
+	}
+	if route.Upstream == "" && route.Root == "" {
+		return nil, fmt.Errorf("route %s requires an upstream or a root directory", path)
+	}
 	for _, opt := range segments[1:] {
 		opt = strings.TrimSpace(opt)
 		if opt == "" {
 			continue
 		}
+		if key, value, ok := strings.Cut(opt, "="); ok {
+			switch strings.ToLower(key) {
+			case "lb":
+				route.LoadBalancing = &config.LoadBalancing{Policy: value}
+			case "health":
+				route.HealthCheck = &config.HealthCheck{Path: value}
+			case "retry":
+				timeout, err := time.ParseDuration(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid retry timeout %s: %w", value, err)
+				}
+				route.Retry = &config.RetryPolicy{Timeout: config.Duration(timeout)}
+			default:
+				return nil, fmt.Errorf("unknown route option %s", opt)
+			}
+			continue
+		}
 		switch strings.ToLower(opt) {
 		case "strip":
 			strip = true
@@ -208,6 +459,10 @@ func parseRouteFlag(value string) (*config.Route, error) {
 			route.SpaFallback = true
 		case "ws", "websocket":
 			route.Websocket = true
+		case "retry":
+			route.Retry = &config.RetryPolicy{}
+		case "browse":
+			route.Browse = true
 		default:
 			return nil, fmt.Errorf("unknown route option %s", opt)
 		}
@@ -215,51 +470,6 @@ func parseRouteFlag(value string) (*config.Route, error) {
 	return route, nil
 }
 
-func validateProject(proj *config.Project) error {
-	if len(proj.Domains) == 0 {
-		return errors.New("project requires at least one domain")
-	}
-	for _, domain := range proj.Domains {
-		if !strings.HasSuffix(strings.ToLower(domain), ".localhost") {
-			return fmt.Errorf("domain %s must end with .localhost", domain)
-		}
-	}
-	if len(proj.Routes) == 0 {
-		return errors.New("project requires at least one route")
-	}
-	return nil
-}
-
-func newListCommand(configPath *string) *cobra.Command {
-	return &cobra.Command{
-		Use:   "list",
-		Short: "List configured projects",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			path := resolveConfigPath(configPath)
-			cfg, err := config.Load(path)
-			if err != nil {
-				return err
-			}
-			if len(cfg.Projects) == 0 {
-				fmt.Fprintln(cmd.OutOrStdout(), "no projects configured")
-				return nil
-			}
-			for name, proj := range cfg.Projects {
-				fmt.Fprintf(cmd.OutOrStdout(), "- %s\n", name)
-				fmt.Fprintf(cmd.OutOrStdout(), "  domains: %s\n", strings.Join(proj.Domains, ", "))
-				for _, route := range proj.Routes {
-					strip := true
-					if route.StripPathPrefix != nil {
-						strip = *route.StripPathPrefix
-					}
-					fmt.Fprintf(cmd.OutOrStdout(), "  route %s -> %s (strip=%t)\n", route.Path, route.Upstream, strip)
-				}
-			}
-			return nil
-		},
-	}
-}
-
 func newRemoveCommand(configPath *string) *cobra.Command {
 	return &cobra.Command{
 		Use:   "remove <project>",
@@ -268,19 +478,21 @@ func newRemoveCommand(configPath *string) *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name := args[0]
 			path := resolveConfigPath(configPath)
-			cfg, err := config.Load(path)
+			err := config.Edit(path, func(cfg *config.Config) error {
+				if _, ok := cfg.Projects[name]; !ok {
+					if source := includedSource(path, cfg, name); source != "" {
+						return fmt.Errorf("project %s is defined in %s; remove it there or unlink the file", name, source)
+					}
+					return fmt.Errorf("project %s not found", name)
+				}
+				delete(cfg.Projects, name)
+				return nil
+			})
 			if err != nil {
 				return err
 			}
-			if _, ok := cfg.Projects[name]; !ok {
-				return fmt.Errorf("project %s not found", name)
-			}
-			delete(cfg.Projects, name)
-			if err := config.Save(path, cfg); err != nil {
-				return err
-			}
 			fmt.Fprintf(cmd.OutOrStdout(), "project %s removed\n", name)
-			return nil
+			return reloadServer(cmd.OutOrStdout())
 		},
 	}
 }
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+const demoConfig = `projects:
+  demo:
+    domains: [demo.localhost]
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:5173
+`
+
+// writeConfig writes content as the configuration in a temporary directory
+// and points the state directory at an empty one, so no running server is
+// reloaded.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	t.Setenv("DEVLINK_STATE_DIR", t.TempDir())
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCLI runs devlink with args against the configuration at path and
+// returns what it printed.
+func runCLI(t *testing.T, path string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := newRootCommand()
+	root.SetArgs(append([]string{"--config", path}, args...))
+	root.SetOut(&out)
+	root.SetErr(&out)
+	root.SetIn(strings.NewReader(""))
+	err := root.Execute()
+	return out.String(), err
+}
+
+func mustRun(t *testing.T, path string, args ...string) string {
+	t.Helper()
+	out, err := runCLI(t, path, args...)
+	if err != nil {
+		t.Fatalf("devlink %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+func loadConfig(t *testing.T, path string) *config.Config {
+	t.Helper()
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	return cfg
+}
+
+func TestAddStoresRelativeRoots(t *testing.T) {
+	path := writeConfig(t, "projects: {}\n")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	out := mustRun(t, path, "add", "docs", "--domain", "docs.localhost", "--route", "/=./site", "--route", "/api=http://127.0.0.1:8080")
+	if out != "project docs saved\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	routes := loadConfig(t, path).Projects["docs"].Routes
+	if len(routes) != 2 || routes[0].Root != "site" || routes[1].Upstream != "http://127.0.0.1:8080" {
+		t.Fatalf("unexpected routes: %+v %+v", routes[0], routes[1])
+	}
+}
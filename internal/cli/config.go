@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/config"
+)
+
+func newConfigCommand(configPath *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and maintain the configuration file",
+	}
+	cmd.AddCommand(newConfigValidateCommand(configPath))
+	cmd.AddCommand(newConfigSchemaCommand())
+	cmd.AddCommand(newConfigMigrateCommand(configPath))
+	return cmd
+}
+
+func newConfigValidateCommand(configPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:          "validate [file]",
+		Short:        "Check the configuration and its included files, reporting every problem with its location",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := resolveConfigPath(configPath)
+			if len(args) == 1 {
+				path = args[0]
+			}
+			snap, err := config.Read(path)
+			if err != nil {
+				return err
+			}
+			err = config.Validate(path, snap.Config)
+			var invalid *config.ValidationError
+			if errors.As(err, &invalid) {
+				for _, p := range invalid.Problems {
+					fmt.Fprintln(cmd.OutOrStdout(), p)
+				}
+				return fmt.Errorf("%d problem(s) found", len(invalid.Problems))
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is valid: %d project(s) from %d file(s)\n", path, len(snap.Config.Projects), len(snap.Files))
+			return nil
+		},
+	}
+}
+
+func newConfigSchemaCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of devlink.yaml for editor validation and completion",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			schema, err := config.Schema()
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(schema)
+			return err
+		},
+	}
+}
+
+func newConfigMigrateCommand(configPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Upgrade a configuration or project file to the current version in place",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := resolveConfigPath(configPath)
+			if len(args) == 1 {
+				path = args[0]
+			}
+			from, err := config.Migrate(path)
+			if err != nil {
+				return err
+			}
+			if from == config.CurrentVersion {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is already at version %d\n", path, from)
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s upgraded from version %d to %d\n", path, from, config.CurrentVersion)
+			return nil
+		},
+	}
+}
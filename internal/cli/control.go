@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/admin"
+	"local-ssl/internal/util"
+)
+
+// connectServer returns a client for the running server, or an error
+// explaining that none is running.
+func connectServer() (*admin.Client, error) {
+	client, err := admin.Connect(util.StateDir())
+	if errors.Is(err, admin.ErrNotRunning) {
+		return nil, errors.New("devlink server is not running; start it with devlink serve")
+	}
+	return client, err
+}
+
+// reloadServer applies a saved configuration change to the running server,
+// if any, instead of waiting for it to notice the file change.
+func reloadServer(out io.Writer) error {
+	client, err := admin.Connect(util.StateDir())
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := client.Reload(ctx); err != nil {
+		return fmt.Errorf("running server rejected the configuration: %w", err)
+	}
+	fmt.Fprintln(out, "running server reloaded")
+	return nil
+}
+
+func newReloadCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the configuration of the running server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := connectServer()
+			if err != nil {
+				return err
+			}
+			reload, err := client.Reload(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "configuration reloaded at %s\n", reload.Time.Format(time.RFC3339))
+			return nil
+		},
+	}
+}
+
+func newDrainCommand() *cobra.Command {
+	var resume bool
+	cmd := &cobra.Command{
+		Use:   "drain <project>",
+		Short: "Stop sending new requests to a project of the running server",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := connectServer()
+			if err != nil {
+				return err
+			}
+			if err := client.Drain(cmd.Context(), args[0], !resume); err != nil {
+				return err
+			}
+			if resume {
+				fmt.Fprintf(cmd.OutOrStdout(), "project %s resumed\n", args[0])
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "project %s drained\n", args[0])
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&resume, "resume", false, "resume traffic to a drained project")
+	return cmd
+}
+
+func newRouteCommand(configPath *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "route",
+		Short: "Manage the routes of a project",
+	}
+	cmd.AddCommand(newRouteAddCommand(configPath))
+	cmd.AddCommand(newRouteUpdateCommand(configPath))
+	cmd.AddCommand(newRouteRemoveCommand(configPath))
+	for _, enable := range []bool{true, false} {
+		enable := enable
+		use, short := "enable", "Enable a route disabled on the running server"
+		if !enable {
+			use, short = "disable", "Disable a route on the running server; requests fall through to the next matching route"
+		}
+		cmd.AddCommand(&cobra.Command{
+			Use:   use + " <project> <path>",
+			Short: short,
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				client, err := connectServer()
+				if err != nil {
+					return err
+				}
+				if err := client.SetRouteEnabled(cmd.Context(), args[0], args[1], enable); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "route %s of project %s %sd\n", args[1], args[0], use)
+				return nil
+			},
+		})
+	}
+	return cmd
+}
@@ -0,0 +1,332 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/admin"
+	"local-ssl/internal/certs"
+	"local-ssl/internal/config"
+	"local-ssl/internal/ports"
+	"local-ssl/internal/server"
+	"local-ssl/internal/util"
+)
+
+// checkResult is the outcome of a single doctor check.
+type checkResult struct {
+	level   string // ok, warn or fail
+	subject string
+	detail  string
+	fix     string
+}
+
+func newDoctorCommand(configPath *string) *cobra.Command {
+	var httpPort, httpsPort int
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the environment and suggest fixes",
+		Args:  cobra.NoArgs,
+		// Failed checks already explain themselves.
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			stateDir := util.StateDir()
+			var status *admin.Status
+			if client, err := admin.Connect(stateDir); err == nil {
+				status, _ = client.Status(ctx)
+			}
+
+			var results []checkResult
+			cfg, configResults := checkConfig(resolveConfigPath(configPath), status)
+			results = append(results, configResults...)
+			results = append(results, checkPort("http", httpPort, status), checkPort("https", httpsPort, status))
+			results = append(results, checkResolution(ctx, cfg)...)
+			results = append(results, checkTrust(stateDir)...)
+			if cfg != nil {
+				results = append(results, checkUpstreams(ctx, cfg, stateDir)...)
+			}
+
+			failed := printChecks(cmd.OutOrStdout(), results)
+			if failed > 0 {
+				return fmt.Errorf("%d check(s) failed", failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&httpPort, "http-port", 80, "HTTP port the server should use")
+	cmd.Flags().IntVar(&httpsPort, "https-port", 443, "HTTPS port the server should use")
+	return cmd
+}
+
+func printChecks(out io.Writer, results []checkResult) (failed int) {
+	for _, r := range results {
+		fmt.Fprintf(out, "%-7s%s: %s\n", "["+r.level+"]", r.subject, r.detail)
+		if r.fix != "" {
+			for _, line := range strings.Split(r.fix, "\n") {
+				fmt.Fprintf(out, "       fix: %s\n", line)
+			}
+		}
+		if r.level == "fail" {
+			failed++
+		}
+	}
+	return failed
+}
+
+func checkConfig(path string, status *admin.Status) (*config.Config, []checkResult) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, []checkResult{{level: "fail", subject: "config", detail: err.Error(), fix: "correct " + path}}
+	}
+	var results []checkResult
+	var invalid *config.ValidationError
+	if errors.As(config.Validate(path, cfg), &invalid) {
+		for _, p := range invalid.Problems {
+			results = append(results, checkResult{level: "fail", subject: p.Path, detail: p.Message, fix: "correct " + p.Location.String()})
+		}
+	} else {
+		results = append(results, checkResult{level: "ok", subject: "config", detail: fmt.Sprintf("%d project(s) in %s", len(cfg.Projects), path)})
+	}
+	if status != nil && status.LastReload.Error != "" {
+		results = append(results, checkResult{
+			level:   "fail",
+			subject: "running server",
+			detail:  "the last reload failed: " + status.LastReload.Error,
+			fix:     "correct the configuration; the server keeps serving the last configuration that loaded",
+		})
+	}
+	return cfg, results
+}
+
+func checkPort(name string, port int, status *admin.Status) checkResult {
+	subject := fmt.Sprintf("port %d (%s)", port, name)
+	if status != nil && (status.HTTPPort == port || status.HTTPSPort == port) {
+		return checkResult{level: "ok", subject: subject, detail: fmt.Sprintf("held by devlink (pid %d)", status.PID)}
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err == nil {
+		ln.Close()
+		return checkResult{level: "ok", subject: subject, detail: "available"}
+	}
+	result := checkResult{level: "fail", subject: subject, detail: err.Error()}
+	switch {
+	case errors.Is(err, syscall.EACCES) || errors.Is(err, os.ErrPermission):
+		switch runtime.GOOS {
+		case "linux":
+			result.fix = "allow binding low ports: sudo setcap cap_net_bind_service=+ep " + executable() +
+				fmt.Sprintf("\nor choose another port with --%s-port", name)
+		default:
+			result.fix = fmt.Sprintf("run devlink serve with administrator rights or choose another port with --%s-port", name)
+		}
+	case errors.Is(err, syscall.EADDRINUSE) || strings.Contains(err.Error(), "address already in use") ||
+		strings.Contains(err.Error(), "Only one usage of each socket address"):
+		if runtime.GOOS == "windows" {
+			result.fix = fmt.Sprintf("find the process with: netstat -ano | findstr :%d", port)
+		} else {
+			result.fix = fmt.Sprintf("find the process with: lsof -nP -iTCP:%d -sTCP:LISTEN", port)
+		}
+		result.fix += fmt.Sprintf("\nstop it or choose another port with --%s-port", name)
+	}
+	return result
+}
+
+func executable() string {
+	if path, err := os.Executable(); err == nil {
+		return path
+	}
+	return "devlink"
+}
+
+func checkResolution(ctx context.Context, cfg *config.Config) []checkResult {
+	hosts := []string{server.InspectorHost}
+	if cfg != nil {
+		for _, project := range cfg.Projects {
+			hosts = append(hosts, project.Domains...)
+		}
+	}
+	sort.Strings(hosts)
+	var results []checkResult
+	var resolved []string
+	seen := map[string]bool{}
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		lookupCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		addrs, err := net.DefaultResolver.LookupIPAddr(lookupCtx, host)
+		cancel()
+		var bad []string
+		for _, addr := range addrs {
+			if !addr.IP.IsLoopback() {
+				bad = append(bad, addr.IP.String())
+			}
+		}
+		switch {
+		case err != nil || len(addrs) == 0:
+			results = append(results, checkResult{
+				level:   "warn",
+				subject: "resolve " + host,
+				detail:  "does not resolve with the system resolver",
+				fix:     "browsers resolve .localhost themselves; for other tools add \"127.0.0.1 " + host + "\" to " + hostsFile(),
+			})
+		case len(bad) > 0:
+			results = append(results, checkResult{
+				level:   "fail",
+				subject: "resolve " + host,
+				detail:  "resolves to non-loopback address " + strings.Join(bad, ", "),
+				fix:     "remove the entry for " + host + " from " + hostsFile() + " or your DNS configuration",
+			})
+		default:
+			resolved = append(resolved, host)
+		}
+	}
+	if len(resolved) > 0 {
+		results = append(results, checkResult{level: "ok", subject: "resolve", detail: strings.Join(resolved, ", ") + " resolve to loopback"})
+	}
+	return results
+}
+
+func hostsFile() string {
+	if runtime.GOOS == "windows" {
+		return `C:\Windows\System32\drivers\etc\hosts`
+	}
+	return "/etc/hosts"
+}
+
+func checkTrust(stateDir string) []checkResult {
+	mgr, err := certs.NewManager(stateDir)
+	if err != nil {
+		return []checkResult{{level: "fail", subject: "certificates", detail: err.Error()}}
+	}
+	infos, err := mgr.Certificates()
+	if err != nil {
+		return []checkResult{{level: "fail", subject: "certificates", detail: err.Error()}}
+	}
+	if len(infos) < 2 {
+		return []checkResult{{level: "warn", subject: "certificates", detail: "not created yet", fix: "run devlink serve once to create them"}}
+	}
+	var results []checkResult
+	for _, info := range infos {
+		left := time.Until(info.NotAfter)
+		switch {
+		case left <= 0:
+			results = append(results, checkResult{level: "fail", subject: info.Name + " certificate", detail: "expired " + info.NotAfter.Format("2006-01-02"), fix: "restart devlink serve to renew it"})
+		case left < 30*24*time.Hour:
+			results = append(results, checkResult{level: "warn", subject: info.Name + " certificate", detail: "expires " + info.NotAfter.Format("2006-01-02"), fix: "restart devlink serve to renew it"})
+		}
+	}
+
+	ca := mgr.CAPath()
+	if err := mgr.VerifySystemTrust(); err != nil {
+		results = append(results, checkResult{level: "fail", subject: "system trust store", detail: "the devlink CA is not trusted", fix: trustFix(ca)})
+	} else {
+		results = append(results, checkResult{level: "ok", subject: "system trust store", detail: "the devlink CA is trusted"})
+	}
+	if r, ok := checkNSS(ca); ok {
+		results = append(results, r)
+	}
+	return results
+}
+
+func trustFix(ca string) string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain " + ca
+	case "windows":
+		return "certutil -addstore -f ROOT " + ca
+	default:
+		return "sudo cp " + ca + " /usr/local/share/ca-certificates/devlink-ca.crt && sudo update-ca-certificates"
+	}
+}
+
+// checkNSS checks the NSS database Chrome and Firefox use on Linux.
+func checkNSS(ca string) (checkResult, bool) {
+	home, err := os.UserHomeDir()
+	if runtime.GOOS != "linux" || err != nil {
+		return checkResult{}, false
+	}
+	db := filepath.Join(home, ".pki", "nssdb")
+	if _, err := os.Stat(db); err != nil {
+		return checkResult{}, false
+	}
+	fix := fmt.Sprintf("certutil -d sql:%s -A -t C,, -n \"Devlink Local CA\" -i %s", db, ca)
+	if _, err := exec.LookPath("certutil"); err != nil {
+		return checkResult{level: "warn", subject: "NSS trust store", detail: "cannot check without certutil (libnss3-tools)", fix: fix}, true
+	}
+	if err := exec.Command("certutil", "-d", "sql:"+db, "-L", "-n", "Devlink Local CA").Run(); err != nil {
+		return checkResult{level: "fail", subject: "NSS trust store", detail: "the devlink CA is not in " + db, fix: fix}, true
+	}
+	return checkResult{level: "ok", subject: "NSS trust store", detail: "the devlink CA is trusted"}, true
+}
+
+// checkUpstreams dials every upstream. Auto-port routes are looked up in
+// the port store without allocating, so the check leaves the state alone.
+func checkUpstreams(ctx context.Context, cfg *config.Config, stateDir string) []checkResult {
+	store := ports.Open(stateDir)
+	names := make([]string, 0, len(cfg.Projects))
+	for name := range cfg.Projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var results []checkResult
+	reachable := 0
+	for _, name := range names {
+		for _, route := range cfg.Projects[name].Routes {
+			targets := route.Targets()
+			if route.Command != nil && route.Command.AutoPort {
+				port, ok, err := store.Lookup(name, route.Path)
+				if err != nil {
+					return append(results, checkResult{level: "fail", subject: "ports", detail: err.Error()})
+				}
+				if !ok {
+					results = append(results, checkResult{
+						level:   "warn",
+						subject: fmt.Sprintf("upstream %s %s", name, route.Path),
+						detail:  "not started; no port has been assigned yet",
+						fix:     "run devlink up " + name + " to start it",
+					})
+					continue
+				}
+				targets = []string{ports.Upstream(route.Upstream, port)}
+			}
+			for _, upstream := range targets {
+				dialCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+				err := server.CheckUpstream(dialCtx, upstream)
+				cancel()
+				if err == nil {
+					reachable++
+					continue
+				}
+				fix := "start the upstream listening on " + upstream
+				if route.Command != nil {
+					fix = "run devlink up " + name + " to start it"
+				}
+				results = append(results, checkResult{
+					level:   "warn",
+					subject: fmt.Sprintf("upstream %s %s", name, route.Path),
+					detail:  fmt.Sprintf("%s is not reachable: %v", upstream, err),
+					fix:     fix,
+				})
+			}
+		}
+	}
+	if reachable > 0 {
+		results = append(results, checkResult{level: "ok", subject: "upstreams", detail: fmt.Sprintf("%d reachable", reachable)})
+	}
+	return results
+}
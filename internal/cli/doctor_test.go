@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/admin"
+	"local-ssl/internal/certs"
+	"local-ssl/internal/config"
+	"local-ssl/internal/ports"
+)
+
+func TestCheckUpstreamsReportsUnstartedAutoPortRoutes(t *testing.T) {
+	stateDir := t.TempDir()
+	cfg := config.New()
+	cfg.Projects["web"] = &config.Project{
+		Domains: []string{"web.localhost"},
+		Routes:  []*config.Route{{Path: "/", Command: &config.Command{Cmd: "npm run dev", AutoPort: true}}},
+	}
+
+	results := checkUpstreams(context.Background(), cfg, stateDir)
+	if len(results) != 1 || results[0].level != "warn" || !strings.Contains(results[0].detail, "not started") || results[0].fix != "run devlink up web to start it" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if _, err := os.Stat(ports.Path(stateDir)); !os.IsNotExist(err) {
+		t.Fatalf("expected doctor not to assign ports, got %v", err)
+	}
+}
+
+// freePort returns a loopback port nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestDoctorLeavesPortAssignmentsAlone(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	started := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer started.Close()
+	down := freePort(t)
+
+	path := writeConfig(t, fmt.Sprintf(`projects:
+  web:
+    domains: [web.localhost]
+    routes:
+      - path: /
+        upstream: %s
+      - path: /down
+        upstream: http://127.0.0.1:%d
+      - path: /app
+        command:
+          cmd: npm run dev
+          autoPort: true
+  other:
+    domains: [other.localhost]
+    routes:
+      - path: /
+        command:
+          cmd: npm run dev
+          autoPort: true
+`, up.URL, down))
+	stateDir := os.Getenv("DEVLINK_STATE_DIR")
+	assigned := fmt.Sprintf(`{"web": {"/app": %d}}`, started.Listener.Addr().(*net.TCPAddr).Port)
+	if err := os.WriteFile(ports.Path(stateDir), []byte(assigned), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := runCLI(t, path, "doctor", "--http-port", fmt.Sprint(freePort(t)), "--https-port", fmt.Sprint(freePort(t)))
+	for _, want := range []string{
+		"[ok]   config: 2 project(s) in " + path + "\n",
+		"[warn] certificates: not created yet\n",
+		"[warn] upstream other /: not started; no port has been assigned yet\n       fix: run devlink up other to start it\n",
+		fmt.Sprintf("[warn] upstream web /down: http://127.0.0.1:%d is not reachable", down),
+		"[ok]   upstreams: 2 reachable\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the output to contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "): available\n") != 2 {
+		t.Errorf("expected both ports to be available:\n%s", out)
+	}
+	data, err := os.ReadFile(ports.Path(stateDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != assigned {
+		t.Fatalf("expected doctor to leave ports.json unchanged, got %s", data)
+	}
+}
+
+func TestCheckPort(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	r := checkPort("https", port, nil)
+	if r.level != "fail" || !strings.Contains(r.fix, "choose another port with --https-port") {
+		t.Fatalf("expected a held port to fail with a fix, got %+v", r)
+	}
+	r = checkPort("https", port, &admin.Status{PID: 7, HTTPSPort: port})
+	if r.level != "ok" || r.detail != "held by devlink (pid 7)" {
+		t.Fatalf("expected the port of the running server to pass, got %+v", r)
+	}
+}
+
+func TestCheckTrust(t *testing.T) {
+	stateDir := t.TempDir()
+	mgr, err := certs.NewManager(stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.EnsureCertificate(); err != nil {
+		t.Fatalf("EnsureCertificate returned error: %v", err)
+	}
+
+	var trust *checkResult
+	for _, r := range checkTrust(stateDir) {
+		if r.subject == "system trust store" {
+			r := r
+			trust = &r
+		}
+		if strings.HasSuffix(r.subject, "certificate") {
+			t.Errorf("expected fresh certificates not to be reported, got %+v", r)
+		}
+	}
+	// A CA created for the test is not in the system store.
+	if trust == nil || trust.level != "fail" || trust.fix != trustFix(mgr.CAPath()) {
+		t.Fatalf("expected the untrusted CA to fail with a fix, got %+v", trust)
+	}
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/config"
+)
+
+func newLinkCommand(configPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "link [dir|file]",
+		Short: "Include a repository's " + config.ProjectFileName + " in the configuration",
+		Long: "Registers the project file of a repository, by default the " + config.ProjectFileName +
+			" in the current directory, in the include list of the configuration.\n" +
+			"The server watches the file and merges its projects with the others.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := "."
+			if len(args) == 1 {
+				target = args[0]
+			}
+			entry, file, err := projectFile(target)
+			if err != nil {
+				return err
+			}
+			names, err := projectFileNames(file)
+			if err != nil {
+				return err
+			}
+			path := resolveConfigPath(configPath)
+			linked := false
+			err = config.Edit(path, func(cfg *config.Config) error {
+				if merged, err := config.Resolve(path, cfg); err == nil {
+					for _, proj := range merged.Projects {
+						if proj.Source == file {
+							return nil
+						}
+					}
+				}
+				cfg.Include = append(cfg.Include, entry)
+				linked = true
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !linked {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is already included\n", file)
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "linked %s: %s\n", file, strings.Join(names, ", "))
+			return reloadServer(cmd.OutOrStdout())
+		},
+	}
+}
+
+func newUnlinkCommand(configPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unlink [dir|file]",
+		Short: "Remove a repository's " + config.ProjectFileName + " from the configuration",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := "."
+			if len(args) == 1 {
+				target = args[0]
+			}
+			abs, err := filepath.Abs(target)
+			if err != nil {
+				return err
+			}
+			// The repository may be gone already, so match both forms link
+			// registers instead of inspecting the target.
+			candidates := map[string]bool{abs: true, filepath.Join(abs, config.ProjectFileName): true}
+			if filepath.Base(abs) == config.ProjectFileName {
+				candidates[filepath.Dir(abs)] = true
+			}
+			path := resolveConfigPath(configPath)
+			err = config.Edit(path, func(cfg *config.Config) error {
+				kept := cfg.Include[:0]
+				for _, entry := range cfg.Include {
+					if !candidates[config.IncludePath(entry, filepath.Dir(path))] {
+						kept = append(kept, entry)
+					}
+				}
+				if len(kept) == len(cfg.Include) {
+					return fmt.Errorf("%s is not linked; it may be included by a glob in %s", target, path)
+				}
+				cfg.Include = kept
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "unlinked %s\n", abs)
+			return reloadServer(cmd.OutOrStdout())
+		},
+	}
+}
+
+// projectFile returns the include entry registering target, a repository
+// directory or a project file, and the project file it stands for.
+func projectFile(target string) (entry, file string, err error) {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		return abs, abs, nil
+	}
+	file = filepath.Join(abs, config.ProjectFileName)
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		return "", "", fmt.Errorf("no %s in %s", config.ProjectFileName, abs)
+	} else if err != nil {
+		return "", "", err
+	}
+	return abs, file, nil
+}
+
+// projectFileNames returns the names of the projects in a project file.
+// Their validation is left to the edit including the file.
+func projectFileNames(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(cfg.Projects) == 0 {
+		return nil, fmt.Errorf("%s defines no projects", file)
+	}
+	names := make([]string, 0, len(cfg.Projects))
+	for name := range cfg.Projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// includedSource returns the project file defining the named project when it
+// comes from an included file rather than the configuration at path.
+func includedSource(path string, cfg *config.Config, name string) string {
+	merged, err := config.Resolve(path, cfg)
+	if err != nil {
+		return ""
+	}
+	if proj, ok := merged.Projects[name]; ok && proj.Source != path {
+		return proj.Source
+	}
+	return ""
+}
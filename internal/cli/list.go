@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/config"
+)
+
+func newListCommand(configPath *string) *cobra.Command {
+	var verbose bool
+	var projects []string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List configured projects",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkOutputFormat(output); err != nil {
+				return err
+			}
+			cfg, err := config.Load(resolveConfigPath(configPath))
+			if err != nil {
+				return err
+			}
+			names := projects
+			if len(names) == 0 {
+				names = make([]string, 0, len(cfg.Projects))
+				for name := range cfg.Projects {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			views := make([]projectView, 0, len(names))
+			for _, name := range names {
+				proj, ok := cfg.Projects[name]
+				if !ok {
+					return fmt.Errorf("project %s not found", name)
+				}
+				views = append(views, newProjectView(name, proj))
+			}
+
+			out := cmd.OutOrStdout()
+			if output != outputTable {
+				return writeStructured(out, output, views)
+			}
+			if len(views) == 0 {
+				fmt.Fprintln(out, "no projects configured")
+				return nil
+			}
+			for _, v := range views {
+				printProject(out, v, verbose)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "show interpolated values and where their variables came from")
+	cmd.Flags().StringSliceVarP(&projects, "project", "p", nil, "only list these projects (repeatable)")
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+// projectView is the listing of a project. It is the schema of
+// `devlink list --output json|yaml`.
+type projectView struct {
+	Name      string              `json:"name"`
+	Source    string              `json:"source"`
+	Domains   []string            `json:"domains"`
+	EnvFile   string              `json:"envFile,omitempty"`
+	Headers   *headersView        `json:"headers,omitempty"`
+	Routes    []routeView         `json:"routes"`
+	Variables []interpolationView `json:"variables,omitempty"`
+}
+
+type routeView struct {
+	Path string `json:"path"`
+	// Kind is proxy, static, mock or replay, as in the routing table.
+	Kind          string             `json:"kind"`
+	Upstreams     []string           `json:"upstreams,omitempty"`
+	Root          string             `json:"root,omitempty"`
+	Index         []string           `json:"index,omitempty"`
+	Browse        bool               `json:"browse,omitempty"`
+	Replay        string             `json:"replay,omitempty"`
+	StripPrefix   bool               `json:"stripPrefix"`
+	Websocket     bool               `json:"websocket"`
+	SpaFallback   bool               `json:"spaFallback"`
+	LoadBalancing *loadBalancingView `json:"loadBalancing,omitempty"`
+	HealthCheck   *healthCheckView   `json:"healthCheck,omitempty"`
+	Retry         *retryView         `json:"retry,omitempty"`
+	Mock          *mockView          `json:"mock,omitempty"`
+	Command       *commandView       `json:"command,omitempty"`
+	Headers       *headersView       `json:"headers,omitempty"`
+}
+
+type headersView struct {
+	Request  []headerRuleView `json:"request,omitempty"`
+	Response []headerRuleView `json:"response,omitempty"`
+}
+
+type headerRuleView struct {
+	// Action is set, add, remove or rename.
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	To     string `json:"to,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type loadBalancingView struct {
+	Policy string `json:"policy"`
+	Cookie string `json:"cookie,omitempty"`
+	Header string `json:"header,omitempty"`
+}
+
+type healthCheckView struct {
+	Path     string `json:"path"`
+	Interval string `json:"interval,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+type retryView struct {
+	Timeout  string `json:"timeout,omitempty"`
+	Interval string `json:"interval,omitempty"`
+}
+
+type mockView struct {
+	Dir       string `json:"dir,omitempty"`
+	Responses int    `json:"responses"`
+}
+
+type commandView struct {
+	Cmd      string `json:"cmd"`
+	Cwd      string `json:"cwd,omitempty"`
+	AutoPort bool   `json:"autoPort,omitempty"`
+	PortEnv  string `json:"portEnv,omitempty"`
+}
+
+type interpolationView struct {
+	Field string         `json:"field"`
+	Raw   string         `json:"raw"`
+	Value string         `json:"value"`
+	Vars  []variableView `json:"vars"`
+}
+
+type variableView struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+func newProjectView(name string, proj *config.Project) projectView {
+	v := projectView{
+		Name:    name,
+		Source:  proj.Source,
+		Domains: proj.Domains,
+		EnvFile: proj.EnvFile,
+		Headers: newHeadersView(proj.Headers),
+		Routes:  make([]routeView, 0, len(proj.Routes)),
+	}
+	for _, route := range proj.Routes {
+		v.Routes = append(v.Routes, newRouteView(route))
+	}
+	for _, i := range proj.Interpolated {
+		iv := interpolationView{Field: i.Field, Raw: i.Raw, Value: i.Value}
+		for _, vr := range i.Vars {
+			iv.Vars = append(iv.Vars, variableView{Name: vr.Name, Source: vr.Source})
+		}
+		v.Variables = append(v.Variables, iv)
+	}
+	return v
+}
+
+func newRouteView(route *config.Route) routeView {
+	v := routeView{
+		Path:        route.Path,
+		Kind:        routeKind(route),
+		Upstreams:   route.Targets(),
+		Root:        route.Root,
+		Index:       route.Index,
+		Browse:      route.Browse,
+		Replay:      route.Replay,
+		StripPrefix: route.StripPathPrefix == nil || *route.StripPathPrefix,
+		Websocket:   route.Websocket,
+		SpaFallback: route.SpaFallback,
+	}
+	if lb := route.LoadBalancing; lb != nil && lb.Policy != "" {
+		v.LoadBalancing = &loadBalancingView{Policy: lb.Policy, Cookie: lb.Cookie, Header: lb.Header}
+	}
+	if hc := route.HealthCheck; hc != nil {
+		v.HealthCheck = &healthCheckView{Path: hc.Path, Interval: durationString(hc.Interval), Timeout: durationString(hc.Timeout)}
+	}
+	if r := route.Retry; r != nil {
+		v.Retry = &retryView{Timeout: durationString(r.Timeout), Interval: durationString(r.Interval)}
+	}
+	if m := route.Mock; m != nil {
+		v.Mock = &mockView{Dir: m.Dir, Responses: len(m.Responses)}
+	}
+	if c := route.Command; c != nil {
+		v.Command = &commandView{Cmd: c.Cmd, Cwd: c.Cwd, AutoPort: c.AutoPort, PortEnv: c.PortEnv}
+	}
+	v.Headers = newHeadersView(route.Headers)
+	return v
+}
+
+func newHeadersView(h *config.Headers) *headersView {
+	if h == nil || len(h.Request)+len(h.Response) == 0 {
+		return nil
+	}
+	return &headersView{Request: headerRuleViews(h.Request), Response: headerRuleViews(h.Response)}
+}
+
+func headerRuleViews(rules []*config.HeaderRule) []headerRuleView {
+	var views []headerRuleView
+	for _, r := range rules {
+		switch {
+		case r == nil:
+		case r.Set != "":
+			views = append(views, headerRuleView{Action: "set", Name: r.Set, Value: r.Value})
+		case r.Add != "":
+			views = append(views, headerRuleView{Action: "add", Name: r.Add, Value: r.Value})
+		case r.Remove != "":
+			views = append(views, headerRuleView{Action: "remove", Name: r.Remove})
+		case r.Rename != "":
+			views = append(views, headerRuleView{Action: "rename", Name: r.Rename, To: r.To})
+		}
+	}
+	return views
+}
+
+// printHeaders summarizes header rules in the table format.
+func printHeaders(out io.Writer, indent string, h *headersView) {
+	if h == nil {
+		return
+	}
+	fmt.Fprintf(out, "%sheaders: %d request, %d response rule(s)\n", indent, len(h.Request), len(h.Response))
+}
+
+// routeKind mirrors how the server picks a handler for a route.
+func routeKind(route *config.Route) string {
+	switch {
+	case route.Mock != nil:
+		return "mock"
+	case route.Root != "":
+		return "static"
+	case route.Replay != "":
+		return "replay"
+	}
+	return "proxy"
+}
+
+func durationString(d config.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func printProject(out io.Writer, v projectView, verbose bool) {
+	fmt.Fprintf(out, "- %s\n", v.Name)
+	fmt.Fprintf(out, "  domains: %s\n", strings.Join(v.Domains, ", "))
+	fmt.Fprintf(out, "  source: %s\n", v.Source)
+	printHeaders(out, "  ", v.Headers)
+	for _, route := range v.Routes {
+		target := strings.Join(route.Upstreams, ", ")
+		switch {
+		case route.Root != "":
+			target = route.Root
+		case route.Replay != "":
+			target = route.Replay
+		case route.Command != nil && route.Command.AutoPort:
+			target = "auto port"
+		}
+		if target == "" {
+			target = route.Kind
+		}
+		details := []string{fmt.Sprintf("strip=%t", route.StripPrefix)}
+		if route.Websocket {
+			details = append(details, "websocket")
+		}
+		if route.SpaFallback {
+			details = append(details, "spa fallback")
+		}
+		fmt.Fprintf(out, "  route %s -> %s (%s)\n", route.Path, target, strings.Join(details, ", "))
+		if route.LoadBalancing != nil {
+			fmt.Fprintf(out, "    load balancing: %s\n", route.LoadBalancing.Policy)
+		}
+		if hc := route.HealthCheck; hc != nil {
+			fmt.Fprintf(out, "    health check: %s", hc.Path)
+			if hc.Timeout != "" {
+				fmt.Fprintf(out, " (timeout %s)", hc.Timeout)
+			}
+			fmt.Fprintln(out)
+		}
+		if route.Retry != nil && route.Retry.Timeout != "" {
+			fmt.Fprintf(out, "    retry: up to %s\n", route.Retry.Timeout)
+		}
+		if route.Mock != nil {
+			fmt.Fprintf(out, "    mock: %d response(s)", route.Mock.Responses)
+			if route.Mock.Dir != "" {
+				fmt.Fprintf(out, ", fixtures in %s", route.Mock.Dir)
+			}
+			fmt.Fprintln(out)
+		}
+		printHeaders(out, "    ", route.Headers)
+	}
+	if verbose {
+		printInterpolations(out, v)
+	}
+}
+
+func printInterpolations(out io.Writer, v projectView) {
+	if v.EnvFile != "" {
+		fmt.Fprintf(out, "  env file: %s\n", v.EnvFile)
+	}
+	if len(v.Variables) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "  variables:")
+	for _, i := range v.Variables {
+		sources := make([]string, 0, len(i.Vars))
+		for _, vr := range i.Vars {
+			sources = append(sources, vr.Name+" from "+vr.Source)
+		}
+		fmt.Fprintf(out, "    %s: %s -> %s (%s)\n", i.Field, i.Raw, i.Value, strings.Join(sources, ", "))
+	}
+}
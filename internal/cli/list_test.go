@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const listConfig = `projects:
+  web:
+    domains: [web.localhost]
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:5173
+        spaFallback: true
+      - path: /api
+        upstreams: [http://127.0.0.1:8080, http://127.0.0.1:8081]
+        loadBalancing:
+          policy: least-connections
+  api:
+    domains: [api.localhost]
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:9000
+        retry:
+          timeout: 5s
+  docs:
+    domains: [docs.localhost]
+    routes:
+      - path: /
+        root: site
+`
+
+func TestListJSON(t *testing.T) {
+	path := writeConfig(t, listConfig)
+
+	var views []projectView
+	if err := json.Unmarshal([]byte(mustRun(t, path, "list", "-o", "json")), &views); err != nil {
+		t.Fatalf("list -o json is not JSON: %v", err)
+	}
+	var names []string
+	for _, v := range views {
+		names = append(names, v.Name)
+	}
+	if strings.Join(names, ",") != "api,docs,web" {
+		t.Fatalf("expected projects sorted by name, got %v", names)
+	}
+	if v := views[0]; v.Source != path || v.Routes[0].Kind != "proxy" || v.Routes[0].Retry == nil || v.Routes[0].Retry.Timeout != "5s" {
+		t.Fatalf("unexpected api project: %+v", v)
+	}
+	if r := views[1].Routes[0]; r.Kind != "static" || r.Root != "site" {
+		t.Fatalf("unexpected docs route: %+v", r)
+	}
+	web := views[2]
+	if r := web.Routes[1]; len(r.Upstreams) != 2 || r.LoadBalancing == nil || r.LoadBalancing.Policy != "least-connections" || !web.Routes[0].SpaFallback {
+		t.Fatalf("unexpected web routes: %+v", web.Routes)
+	}
+}
+
+func TestListYAMLWithProjectFilter(t *testing.T) {
+	path := writeConfig(t, listConfig)
+
+	out := mustRun(t, path, "list", "-o", "yaml", "--project", "web", "-p", "api")
+	var views []map[string]interface{}
+	if err := yaml.Unmarshal([]byte(out), &views); err != nil {
+		t.Fatalf("list -o yaml is not YAML: %v\n%s", err, out)
+	}
+	if len(views) != 2 || views[0]["name"] != "api" || views[1]["name"] != "web" {
+		t.Fatalf("expected api and web in name order, got:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "- name: api\n") {
+		t.Fatalf("expected block style YAML, got:\n%s", out)
+	}
+
+	if _, err := runCLI(t, path, "list", "--project", "missing"); err == nil || !strings.Contains(err.Error(), "project missing not found") {
+		t.Fatalf("expected an unknown project to fail, got %v", err)
+	}
+	if _, err := runCLI(t, path, "list", "-o", "xml"); err == nil {
+		t.Fatal("expected an unknown output format to fail")
+	}
+}
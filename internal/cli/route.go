@@ -0,0 +1,448 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"local-ssl/internal/config"
+)
+
+// errDryRun stops an edit after the diff was printed.
+var errDryRun = errors.New("dry run")
+
+// routeOptions holds the route fields settable from the command line.
+type routeOptions struct {
+	upstreams      []string
+	root           string
+	index          []string
+	browse         bool
+	replay         string
+	mockDir        string
+	strip          bool
+	spa            bool
+	websocket      bool
+	lb             string
+	lbCookie       string
+	lbHeader       string
+	health         string
+	healthInterval time.Duration
+	healthTimeout  time.Duration
+	healthStatus   int
+	retry          bool
+	retryTimeout   time.Duration
+	command        string
+	cwd            string
+	env            []string
+	autoPort       bool
+	portEnv        string
+	readyPath      string
+	readyPort      int
+	unset          []string
+	dryRun         bool
+}
+
+// unsettable lists the names accepted by --unset.
+var unsettable = []string{"upstream", "root", "index", "replay", "mock", "strip-prefix", "lb", "health", "retry", "command", "env", "ready", "headers"}
+
+func (o *routeOptions) register(cmd *cobra.Command, update bool) {
+	f := cmd.Flags()
+	f.StringArrayVar(&o.upstreams, "upstream", nil, "upstream URL; repeat for several upstreams")
+	f.StringVar(&o.root, "root", "", "serve static files from this directory")
+	f.StringSliceVar(&o.index, "index", nil, "index file names of a static route")
+	f.BoolVar(&o.browse, "browse", false, "list directories of a static route")
+	f.StringVar(&o.replay, "replay", "", "serve the responses recorded in this HAR file")
+	f.StringVar(&o.mockDir, "mock-dir", "", "serve mock fixtures from this directory")
+	f.BoolVar(&o.strip, "strip-prefix", true, "strip the route path before proxying")
+	f.BoolVar(&o.spa, "spa", false, "serve / for unmatched HTML requests (SPA fallback)")
+	f.BoolVar(&o.websocket, "websocket", false, "mark the route as carrying WebSocket traffic")
+	f.StringVar(&o.lb, "lb", "", "load balancing policy: round-robin, least-connections, cookie or header")
+	f.StringVar(&o.lbCookie, "lb-cookie", "", "sticky session cookie of the cookie policy")
+	f.StringVar(&o.lbHeader, "lb-header", "", "request header hashed by the header policy")
+	f.StringVar(&o.health, "health", "", "health check path")
+	f.DurationVar(&o.healthInterval, "health-interval", 0, "health check interval")
+	f.DurationVar(&o.healthTimeout, "health-timeout", 0, "health check timeout")
+	f.IntVar(&o.healthStatus, "health-status", 0, "expected health check status")
+	f.BoolVar(&o.retry, "retry", false, "hold idempotent requests while the upstream refuses connections")
+	f.DurationVar(&o.retryTimeout, "retry-timeout", 0, "how long requests are held (implies --retry)")
+	f.StringVar(&o.command, "cmd", "", "dev server command started by devlink up")
+	f.StringVar(&o.cwd, "cwd", "", "working directory of the command")
+	f.StringArrayVar(&o.env, "env", nil, "KEY=VALUE environment variable of the command; repeatable")
+	f.BoolVar(&o.autoPort, "auto-port", false, "allocate a free port for the command")
+	f.StringVar(&o.portEnv, "port-env", "", "variable receiving the allocated port (default PORT)")
+	f.StringVar(&o.readyPath, "ready-path", "", "HTTP path probed before the command receives traffic")
+	f.IntVar(&o.readyPort, "ready-port", 0, "loopback port probed instead of the upstream")
+	if update {
+		f.StringSliceVar(&o.unset, "unset", nil, "remove settings: "+strings.Join(unsettable, ", "))
+	}
+	f.BoolVar(&o.dryRun, "dry-run", false, "print the diff without saving")
+}
+
+// apply updates route with the flags given on the command line. Paths are
+// rebased onto baseDir, the directory of the configuration file, which
+// relative paths of the configuration are resolved against.
+func (o *routeOptions) apply(route *config.Route, baseDir string, changed func(string) bool) error {
+	for _, name := range o.unset {
+		switch name {
+		case "upstream":
+			route.Upstream, route.Upstreams = "", nil
+		case "root":
+			route.Root = ""
+		case "index":
+			route.Index = nil
+		case "replay":
+			route.Replay = ""
+		case "mock":
+			route.Mock = nil
+		case "strip-prefix":
+			route.StripPathPrefix = nil
+		case "lb":
+			route.LoadBalancing = nil
+		case "health":
+			route.HealthCheck = nil
+		case "retry":
+			route.Retry = nil
+		case "command":
+			route.Command = nil
+		case "env":
+			if route.Command != nil {
+				route.Command.Env = nil
+			}
+		case "ready":
+			if route.Command != nil {
+				route.Command.Ready = nil
+			}
+		case "headers":
+			route.Headers = nil
+		default:
+			return fmt.Errorf("cannot unset %q; use one of %s", name, strings.Join(unsettable, ", "))
+		}
+	}
+
+	if changed("upstream") {
+		route.Upstream, route.Upstreams = "", nil
+		for _, upstream := range o.upstreams {
+			if route.Upstream == "" {
+				route.Upstream = upstream
+			} else {
+				route.Upstreams = append(route.Upstreams, upstream)
+			}
+		}
+	}
+	var err error
+	if changed("root") {
+		if route.Root, err = configRelative(baseDir, o.root); err != nil {
+			return err
+		}
+	}
+	if changed("index") {
+		route.Index = o.index
+	}
+	if changed("browse") {
+		route.Browse = o.browse
+	}
+	if changed("replay") {
+		if route.Replay, err = configRelative(baseDir, o.replay); err != nil {
+			return err
+		}
+	}
+	if changed("mock-dir") {
+		if route.Mock == nil {
+			route.Mock = &config.Mock{}
+		}
+		if route.Mock.Dir, err = configRelative(baseDir, o.mockDir); err != nil {
+			return err
+		}
+	}
+	if changed("strip-prefix") {
+		strip := o.strip
+		route.StripPathPrefix = &strip
+	}
+	if changed("spa") {
+		route.SpaFallback = o.spa
+	}
+	if changed("websocket") {
+		route.Websocket = o.websocket
+	}
+
+	if changed("lb") || changed("lb-cookie") || changed("lb-header") {
+		if route.LoadBalancing == nil {
+			route.LoadBalancing = &config.LoadBalancing{}
+		}
+		if changed("lb") {
+			route.LoadBalancing.Policy = o.lb
+		}
+		if changed("lb-cookie") {
+			route.LoadBalancing.Cookie = o.lbCookie
+		}
+		if changed("lb-header") {
+			route.LoadBalancing.Header = o.lbHeader
+		}
+	}
+	if changed("health") || changed("health-interval") || changed("health-timeout") || changed("health-status") {
+		if route.HealthCheck == nil {
+			route.HealthCheck = &config.HealthCheck{}
+		}
+		if changed("health") {
+			route.HealthCheck.Path = o.health
+		}
+		if changed("health-interval") {
+			route.HealthCheck.Interval = config.Duration(o.healthInterval)
+		}
+		if changed("health-timeout") {
+			route.HealthCheck.Timeout = config.Duration(o.healthTimeout)
+		}
+		if changed("health-status") {
+			route.HealthCheck.ExpectStatus = o.healthStatus
+		}
+	}
+	if changed("retry") && !o.retry {
+		route.Retry = nil
+	} else if changed("retry") || changed("retry-timeout") {
+		if route.Retry == nil {
+			route.Retry = &config.RetryPolicy{}
+		}
+		if changed("retry-timeout") {
+			route.Retry.Timeout = config.Duration(o.retryTimeout)
+		}
+	}
+
+	commandFlags := []string{"cmd", "cwd", "env", "auto-port", "port-env", "ready-path", "ready-port"}
+	for _, name := range commandFlags {
+		if changed(name) && route.Command == nil {
+			route.Command = &config.Command{}
+		}
+	}
+	if c := route.Command; c != nil {
+		if changed("cmd") {
+			c.Cmd = o.command
+		}
+		if changed("cwd") {
+			if c.Cwd, err = configRelative(baseDir, o.cwd); err != nil {
+				return err
+			}
+		}
+		for _, pair := range o.env {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid --env %q; use KEY=VALUE", pair)
+			}
+			if c.Env == nil {
+				c.Env = map[string]string{}
+			}
+			c.Env[key] = value
+		}
+		if changed("auto-port") {
+			c.AutoPort = o.autoPort
+		}
+		if changed("port-env") {
+			c.PortEnv = o.portEnv
+		}
+		if changed("ready-path") || changed("ready-port") {
+			if c.Ready == nil {
+				c.Ready = &config.ReadyProbe{}
+			}
+			if changed("ready-path") {
+				c.Ready.Path = o.readyPath
+			}
+			if changed("ready-port") {
+				c.Ready.Port = o.readyPort
+			}
+		}
+	}
+	return nil
+}
+
+// routeEdit changes one route of a project in the configuration file.
+// change receives the project's routes and returns them updated.
+type routeEdit func(project string, routes []*config.Route) ([]*config.Route, error)
+
+func editRoutes(cmd *cobra.Command, configPath *string, project string, dryRun bool, change routeEdit) error {
+	path := resolveConfigPath(configPath)
+	out := cmd.OutOrStdout()
+	err := config.Edit(path, func(cfg *config.Config) error {
+		proj, ok := cfg.Projects[project]
+		if !ok {
+			if source := includedSource(path, cfg, project); source != "" {
+				return fmt.Errorf("project %s is defined in %s; edit that file instead", project, source)
+			}
+			return fmt.Errorf("project %s not found", project)
+		}
+		before, err := projectYAML(project, proj)
+		if err != nil {
+			return err
+		}
+		routes := make([]*config.Route, 0, len(proj.Routes))
+		for _, r := range proj.Routes {
+			routes = append(routes, r.Clone())
+		}
+		if proj.Routes, err = change(project, routes); err != nil {
+			return err
+		}
+		after, err := projectYAML(project, proj)
+		if err != nil {
+			return err
+		}
+		printDiff(out, before, after)
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "project %s saved\n", project)
+	return reloadServer(out)
+}
+
+// configRelative turns path, given relative to the working directory, into
+// a path relative to baseDir, so the configuration does not carry paths of
+// this machine. Absolute paths are kept as given.
+func configRelative(baseDir, path string) (string, error) {
+	if path == "" || filepath.IsAbs(path) {
+		return path, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		// On another volume; only an absolute path reaches it.
+		return abs, nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func findRoute(routes []*config.Route, path string) int {
+	for i, r := range routes {
+		if r.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func newRouteAddCommand(configPath *string) *cobra.Command {
+	opts := &routeOptions{}
+	cmd := &cobra.Command{
+		Use:   "add <project> <path>",
+		Short: "Add a route to a project",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, path := args[0], args[1]
+			return editRoutes(cmd, configPath, project, opts.dryRun, func(project string, routes []*config.Route) ([]*config.Route, error) {
+				if findRoute(routes, path) >= 0 {
+					return nil, fmt.Errorf("project %s already has a route %s; use devlink route update", project, path)
+				}
+				route := &config.Route{Path: path}
+				if err := opts.apply(route, filepath.Dir(resolveConfigPath(configPath)), cmd.Flags().Changed); err != nil {
+					return nil, err
+				}
+				return append(routes, route), nil
+			})
+		},
+	}
+	opts.register(cmd, false)
+	return cmd
+}
+
+func newRouteUpdateCommand(configPath *string) *cobra.Command {
+	opts := &routeOptions{}
+	cmd := &cobra.Command{
+		Use:   "update <project> <path>",
+		Short: "Change the given settings of a route",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, path := args[0], args[1]
+			return editRoutes(cmd, configPath, project, opts.dryRun, func(project string, routes []*config.Route) ([]*config.Route, error) {
+				i := findRoute(routes, path)
+				if i < 0 {
+					return nil, fmt.Errorf("project %s has no route %s", project, path)
+				}
+				if err := opts.apply(routes[i], filepath.Dir(resolveConfigPath(configPath)), cmd.Flags().Changed); err != nil {
+					return nil, err
+				}
+				return routes, nil
+			})
+		},
+	}
+	opts.register(cmd, true)
+	return cmd
+}
+
+func newRouteRemoveCommand(configPath *string) *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "remove <project> <path>",
+		Short: "Remove a route from a project",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, path := args[0], args[1]
+			return editRoutes(cmd, configPath, project, dryRun, func(project string, routes []*config.Route) ([]*config.Route, error) {
+				i := findRoute(routes, path)
+				if i < 0 {
+					return nil, fmt.Errorf("project %s has no route %s", project, path)
+				}
+				return append(routes[:i], routes[i+1:]...), nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the diff without saving")
+	return cmd
+}
+
+func projectYAML(name string, proj *config.Project) ([]string, error) {
+	data, err := yaml.Marshal(map[string]*config.Project{name: proj})
+	if err != nil {
+		return nil, fmt.Errorf("marshal project: %w", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// printDiff writes after with the lines removed from before marked "-" and
+// the added ones "+", based on their longest common subsequence.
+func printDiff(out io.Writer, before, after []string) {
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			fmt.Fprintf(out, "  %s\n", before[i])
+			i++
+			j++
+		case i < len(before) && (j == len(after) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(out, "- %s\n", before[i])
+			i++
+		default:
+			fmt.Fprintf(out, "+ %s\n", after[j])
+			j++
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouteAddUpdateRemove(t *testing.T) {
+	path := writeConfig(t, demoConfig)
+
+	out := mustRun(t, path, "route", "add", "demo", "/api", "--upstream", "http://127.0.0.1:8080", "--health", "/healthz", "--retry")
+	for _, want := range []string{
+		"+         - path: /api\n",
+		"+           upstream: http://127.0.0.1:8080\n",
+		"project demo saved\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the output to contain %q:\n%s", want, out)
+		}
+	}
+	routes := loadConfig(t, path).Projects["demo"].Routes
+	if len(routes) != 2 || routes[1].Path != "/api" || routes[1].HealthCheck == nil || routes[1].HealthCheck.Path != "/healthz" || routes[1].Retry == nil {
+		t.Fatalf("unexpected routes after add: %+v", routes)
+	}
+
+	if _, err := runCLI(t, path, "route", "add", "demo", "/api", "--upstream", "http://127.0.0.1:9090"); err == nil || !strings.Contains(err.Error(), "already has a route /api") {
+		t.Fatalf("expected adding an existing path to fail, got %v", err)
+	}
+
+	out = mustRun(t, path, "route", "update", "demo", "/api", "--upstream", "http://127.0.0.1:9090", "--upstream", "http://127.0.0.1:9091", "--unset", "health")
+	if !strings.Contains(out, "-           upstream: http://127.0.0.1:8080\n") || !strings.Contains(out, "-           healthCheck:\n") {
+		t.Errorf("expected the diff to show the removed settings:\n%s", out)
+	}
+	routes = loadConfig(t, path).Projects["demo"].Routes
+	if len(routes) != 2 {
+		t.Fatalf("expected the route to be replaced, not duplicated: %+v", routes)
+	}
+	r := routes[1]
+	if r.Upstream != "http://127.0.0.1:9090" || len(r.Upstreams) != 1 || r.Upstreams[0] != "http://127.0.0.1:9091" || r.HealthCheck != nil || r.Retry == nil {
+		t.Fatalf("unexpected route after update: %+v", r)
+	}
+
+	if _, err := runCLI(t, path, "route", "update", "demo", "/api", "--unset", "bogus"); err == nil || !strings.Contains(err.Error(), `cannot unset "bogus"`) {
+		t.Fatalf("expected an unknown --unset to fail, got %v", err)
+	}
+
+	out = mustRun(t, path, "route", "remove", "demo", "/api")
+	if !strings.Contains(out, "-         - path: /api\n") {
+		t.Errorf("expected the diff to show the removed route:\n%s", out)
+	}
+	routes = loadConfig(t, path).Projects["demo"].Routes
+	if len(routes) != 1 || routes[0].Path != "/" {
+		t.Fatalf("unexpected routes after remove: %+v", routes)
+	}
+	if _, err := runCLI(t, path, "route", "remove", "demo", "/api"); err == nil {
+		t.Fatal("expected removing a missing route to fail")
+	}
+}
+
+func TestRouteDryRunLeavesConfigUnchanged(t *testing.T) {
+	path := writeConfig(t, demoConfig)
+
+	out := mustRun(t, path, "route", "update", "demo", "/", "--upstream", "http://127.0.0.1:3000", "--spa", "--dry-run")
+	want := "  demo:\n" +
+		"      domains:\n" +
+		"          - demo.localhost\n" +
+		"      routes:\n" +
+		"          - path: /\n" +
+		"-           upstream: http://127.0.0.1:5173\n" +
+		"+           upstream: http://127.0.0.1:3000\n" +
+		"+           spaFallback: true\n"
+	if out != want {
+		t.Fatalf("unexpected dry run output:\n%s\nwant:\n%s", out, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != demoConfig {
+		t.Fatalf("expected --dry-run not to save, got:\n%s", data)
+	}
+}
+
+func TestRoutePathsAreRelativeToConfig(t *testing.T) {
+	path := writeConfig(t, demoConfig)
+	dir := filepath.Dir(path)
+	if err := os.Mkdir(filepath.Join(dir, "web"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(dir, "web")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	abs := filepath.Join(t.TempDir(), "fixtures")
+	mustRun(t, path, "route", "add", "demo", "/docs", "--root", "./dist")
+	mustRun(t, path, "route", "add", "demo", "/app", "--upstream", "http://127.0.0.1:3000", "--cmd", "npm run dev", "--cwd", ".")
+	mustRun(t, path, "route", "add", "demo", "/mock", "--mock-dir", abs)
+	routes := loadConfig(t, path).Projects["demo"].Routes
+	if root, cwd := routes[1].Root, routes[2].Command.Cwd; root != "web/dist" || cwd != "web" {
+		t.Fatalf("expected paths relative to the config directory, got root %q cwd %q", root, cwd)
+	}
+	if m := routes[3].Mock; m == nil || m.Dir != abs {
+		t.Fatalf("expected the absolute mock directory to be kept, got %+v", m)
+	}
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"local-ssl/internal/admin"
+	"local-ssl/internal/certs"
+)
+
+func newStatusCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Summarize the running server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkOutputFormat(output); err != nil {
+				return err
+			}
+			client, err := connectServer()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			status, err := client.Status(ctx)
+			if err != nil {
+				return err
+			}
+			routes, err := client.Routes(ctx)
+			if err != nil {
+				return err
+			}
+			health, err := client.Health(ctx)
+			if err != nil {
+				return err
+			}
+			certificates, err := client.Certificates(ctx)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if output != outputTable {
+				return writeStructured(out, output, statusView{
+					Server:       status,
+					Routes:       routes,
+					Health:       health,
+					Certificates: certificates,
+				})
+			}
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "server\trunning (pid %d, up %s)\n", status.PID, time.Since(status.StartedAt).Round(time.Second))
+			fmt.Fprintf(w, "config\t%s\n", status.ConfigPath)
+			fmt.Fprintf(w, "ports\thttp %d, https %d\n", status.HTTPPort, status.HTTPSPort)
+			if status.InspectorURL != "" {
+				fmt.Fprintf(w, "inspector\t%s\n", status.InspectorURL)
+			}
+			if status.MetricsAddr != "" {
+				fmt.Fprintf(w, "metrics\thttp://%s/metrics\n", status.MetricsAddr)
+			}
+			reload := "ok"
+			if status.LastReload.Error != "" {
+				reload = "failed, serving the last good configuration: " + status.LastReload.Error
+			}
+			fmt.Fprintf(w, "last reload\t%s (%s)\n", reload, status.LastReload.Time.Format(time.RFC3339))
+			for _, c := range certificates {
+				days := int(time.Until(c.NotAfter).Hours() / 24)
+				fmt.Fprintf(w, "certificate %s\texpires %s (%d days)\n", c.Name, c.NotAfter.Format("2006-01-02"), days)
+			}
+			w.Flush()
+
+			if len(routes) == 0 {
+				fmt.Fprintln(out, "\nno projects loaded")
+				return nil
+			}
+			fmt.Fprintln(out)
+			w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROJECT\tDOMAINS\tPATH\tKIND\tUPSTREAMS\tOPTIONS\tSTATE\tSOURCE")
+			for _, r := range routes {
+				state := "active"
+				switch {
+				case r.Draining:
+					state = "draining"
+				case !r.Enabled:
+					state = "disabled"
+				}
+				upstreams := upstreamHealth(r, health)
+				if upstreams == "" {
+					upstreams = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Project, strings.Join(r.Domains, ", "), r.Path, r.Kind, upstreams, routeSettings(r), state, r.Source)
+			}
+			return w.Flush()
+		},
+	}
+	addOutputFlag(cmd, &output)
+	return cmd
+}
+
+// statusView is the schema of `devlink status --output json|yaml`.
+type statusView struct {
+	Server       *admin.Status           `json:"server"`
+	Routes       []admin.Route           `json:"routes"`
+	Health       []admin.UpstreamStatus  `json:"health"`
+	Certificates []certs.CertificateInfo `json:"certificates"`
+}
+
+// upstreamHealth lists the upstreams of r, marking the targets that failed
+// their health checks and are taken out of rotation.
+func upstreamHealth(r admin.Route, health []admin.UpstreamStatus) string {
+	ejected := map[string]bool{}
+	for _, h := range health {
+		if h.Project == r.Project && h.Route == r.Path && !h.Healthy {
+			ejected[h.Upstream] = true
+		}
+	}
+	upstreams := make([]string, 0, len(r.Upstreams))
+	for _, u := range r.Upstreams {
+		if ejected[u] {
+			u += " (unhealthy)"
+		}
+		upstreams = append(upstreams, u)
+	}
+	return strings.Join(upstreams, ", ")
+}
+
+// routeSettings summarizes the route settings shown in the OPTIONS column.
+func routeSettings(r admin.Route) string {
+	var opts []string
+	if r.StripPrefix {
+		opts = append(opts, "strip")
+	}
+	if r.Websocket {
+		opts = append(opts, "websocket")
+	}
+	if r.SpaFallback {
+		opts = append(opts, "spa")
+	}
+	if r.RetryTimeout != "" {
+		opts = append(opts, "retry "+r.RetryTimeout)
+	}
+	if r.HealthTimeout != "" {
+		opts = append(opts, "health "+r.HealthTimeout)
+	}
+	if len(opts) == 0 {
+		return "-"
+	}
+	return strings.Join(opts, ", ")
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"local-ssl/internal/admin"
+	"local-ssl/internal/certs"
+)
+
+// serveControl answers the control API on the socket of a new state
+// directory with the given responses, keyed by path.
+func serveControl(t *testing.T, responses map[string]interface{}) string {
+	t.Helper()
+	stateDir := t.TempDir()
+	t.Setenv("DEVLINK_STATE_DIR", stateDir)
+	ln, err := net.Listen("unix", admin.SocketPath(stateDir))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return stateDir
+}
+
+func statusResponses() map[string]interface{} {
+	return map[string]interface{}{
+		"/v1/status": admin.Status{PID: 42, StartedAt: time.Now(), ConfigPath: "/etc/devlink.yaml", HTTPPort: 80, HTTPSPort: 443},
+		"/v1/routes": []admin.Route{{
+			Project:   "web",
+			Domains:   []string{"web.localhost"},
+			Path:      "/api",
+			Kind:      "proxy",
+			Upstreams: []string{"http://127.0.0.1:8080", "http://127.0.0.1:8081"},
+			Enabled:   true,
+		}},
+		"/v1/health": []admin.UpstreamStatus{
+			{Project: "web", Route: "/api", Upstream: "http://127.0.0.1:8080", Healthy: true},
+			{Project: "web", Route: "/api", Upstream: "http://127.0.0.1:8081", Healthy: false},
+		},
+		"/v1/certs": []certs.CertificateInfo{{Name: "ca", NotAfter: time.Now().Add(48 * time.Hour)}},
+	}
+}
+
+func TestStatusShowsTargetHealth(t *testing.T) {
+	serveControl(t, statusResponses())
+
+	out := mustRun(t, "", "status")
+	if !strings.Contains(out, "http://127.0.0.1:8080, http://127.0.0.1:8081 (unhealthy)") {
+		t.Fatalf("expected the ejected target to be marked:\n%s", out)
+	}
+
+	var view struct {
+		Health []admin.UpstreamStatus `json:"health"`
+	}
+	if err := json.Unmarshal([]byte(mustRun(t, "", "status", "-o", "json")), &view); err != nil {
+		t.Fatalf("status -o json is not JSON: %v", err)
+	}
+	if len(view.Health) != 2 || view.Health[1].Healthy {
+		t.Fatalf("unexpected health in JSON: %+v", view.Health)
+	}
+	if out := mustRun(t, "", "status", "-o", "yaml"); !strings.Contains(out, "healthy: false") {
+		t.Fatalf("expected target health in YAML:\n%s", out)
+	}
+}
+
+func TestStatusSummarizesServer(t *testing.T) {
+	responses := statusResponses()
+	status := responses["/v1/status"].(admin.Status)
+	status.LastReload = admin.Reload{Time: time.Now(), Error: "projects.web: no routes"}
+	responses["/v1/status"] = status
+	responses["/v1/routes"] = []admin.Route{
+		{Project: "api", Domains: []string{"api.localhost"}, Path: "/", Kind: "proxy", Upstreams: []string{"http://127.0.0.1:9000"}, StripPrefix: true, RetryTimeout: "5s", Enabled: true, Draining: true, Source: "/etc/devlink.yaml"},
+		{Project: "docs", Domains: []string{"docs.localhost"}, Path: "/", Kind: "static", Source: "/etc/devlink.yaml"},
+	}
+	serveControl(t, responses)
+
+	out := mustRun(t, "", "status")
+	for _, want := range []string{
+		"server          running (pid 42, up ",
+		"last reload     failed, serving the last good configuration: projects.web: no routes",
+		"certificate ca  expires ",
+		"PROJECT  DOMAINS         PATH  KIND    UPSTREAMS              OPTIONS          STATE     SOURCE\n",
+		"api      api.localhost   /     proxy   http://127.0.0.1:9000  strip, retry 5s  draining  /etc/devlink.yaml\n",
+		"docs     docs.localhost  /     static  -                      -                disabled  /etc/devlink.yaml\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the output to contain %q:\n%s", want, out)
+		}
+	}
+
+	responses["/v1/routes"] = []admin.Route{}
+	if out := mustRun(t, "", "status"); !strings.HasSuffix(out, "\nno projects loaded\n") {
+		t.Errorf("expected an empty routing table to be reported:\n%s", out)
+	}
+}
+
+func TestStatusWithoutServer(t *testing.T) {
+	t.Setenv("DEVLINK_STATE_DIR", t.TempDir())
+	if _, err := runCLI(t, "", "status"); err == nil || !strings.Contains(err.Error(), "devlink server is not running") {
+		t.Fatalf("expected status to report that no server runs, got %v", err)
+	}
+}
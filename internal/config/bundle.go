@@ -0,0 +1,373 @@
+package config
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundleVersion is the bundle layout this build reads and writes.
+const BundleVersion = 1
+
+// Bundle is a portable project definition, written by `devlink export` and
+// added with `devlink import`. Its values may reference the bundle's
+// parameters as ${NAME}; they are substituted when the bundle is expanded,
+// while other ${VAR} references are kept for interpolation at load time.
+type Bundle struct {
+	Name        string
+	Description string
+	Params      []Param
+	project     *yaml.Node
+}
+
+// Param is a placeholder of a bundle. A parameter without a default must be
+// given a value when the bundle is expanded.
+type Param struct {
+	Name        string `yaml:"name"`
+	Default     string `yaml:"default,omitempty"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// bundleFile is the YAML layout of a bundle.
+type bundleFile struct {
+	Version     int      `yaml:"version"`
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Params      []Param  `yaml:"params,omitempty"`
+	Project     *Project `yaml:"project"`
+}
+
+// ParseBundle decodes a bundle. Unknown fields are rejected with their line
+// numbers; the project is decoded by Expand once parameters are known.
+func ParseBundle(data []byte) (*Bundle, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("bundle is empty")
+	}
+	root := doc.Content[0]
+	if err := checkFields(root, reflect.TypeOf(bundleFile{}), ""); err != nil {
+		return nil, err
+	}
+	// The project may hold placeholders in fields that are not strings, so
+	// only the header is decoded here.
+	header := *root
+	header.Content = nil
+	var project *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "project" {
+			project = root.Content[i+1]
+			continue
+		}
+		header.Content = append(header.Content, root.Content[i], root.Content[i+1])
+	}
+	var file bundleFile
+	if err := header.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if file.Version > BundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than this devlink supports (%d)", file.Version, BundleVersion)
+	}
+	if project == nil || project.Kind != yaml.MappingNode {
+		return nil, errors.New("bundle has no project")
+	}
+	seen := map[string]bool{}
+	for _, p := range file.Params {
+		if !validVariableName(p.Name) {
+			return nil, fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("parameter %s is declared twice", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return &Bundle{Name: file.Name, Description: file.Description, Params: file.Params, project: project}, nil
+}
+
+// ReadBundle reads a bundle from a file.
+func ReadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read bundle: %w", err)
+	}
+	b, err := ParseBundle(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// NewBundle describes a project as a bundle named name. The project should
+// hold raw values, as read from its file, so that environment references
+// stay portable. With parameterize, the ports of loopback upstreams become
+// parameters defaulting to their current value.
+func NewBundle(name string, proj *Project, parameterize bool) (*Bundle, error) {
+	var project yaml.Node
+	if err := project.Encode(proj); err != nil {
+		return nil, fmt.Errorf("encode project %s: %w", name, err)
+	}
+	b := &Bundle{Name: name, project: &project}
+	if parameterize {
+		b.Params = parameterizePorts(&project)
+	}
+	return b, nil
+}
+
+// Marshal encodes the bundle as YAML.
+func (b *Bundle) Marshal() ([]byte, error) {
+	var doc yaml.Node
+	err := doc.Encode(bundleFile{
+		Version:     BundleVersion,
+		Name:        b.Name,
+		Description: b.Description,
+		Params:      b.Params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal bundle: %w", err)
+	}
+	// Replace the empty project with the bundle's, which may hold
+	// placeholders a Project cannot.
+	_, value := mappingValue(&doc, "project")
+	*value = *b.project
+	return yaml.Marshal(&doc)
+}
+
+// Expand substitutes the parameters and decodes the project. values
+// override the defaults; naming an undeclared parameter is an error.
+func (b *Bundle) Expand(values map[string]string) (*Project, error) {
+	resolved := map[string]string{}
+	for _, p := range b.Params {
+		value, ok := values[p.Name]
+		if !ok {
+			value = p.Default
+		}
+		if value == "" {
+			return nil, fmt.Errorf("parameter %s is required", p.Name)
+		}
+		resolved[p.Name] = value
+	}
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			return nil, fmt.Errorf("bundle %s has no parameter %s", b.Name, name)
+		}
+	}
+	node := copyNode(b.project)
+	substituteParams(node, resolved)
+	if err := checkFields(node, reflect.TypeOf(Project{}), "project"); err != nil {
+		return nil, err
+	}
+	proj := &Project{}
+	if err := node.Decode(proj); err != nil {
+		return nil, fmt.Errorf("decode project: %w", err)
+	}
+	return proj, nil
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// substituteParams replaces ${NAME} references to params in the scalar
+// values below node. Substituted values are escaped, so interpolation at
+// load time keeps them literal.
+func substituteParams(node *yaml.Node, params map[string]string) {
+	if node.Kind == yaml.MappingNode {
+		for i := 1; i < len(node.Content); i += 2 {
+			substituteParams(node.Content[i], params)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		substituteParams(child, params)
+	}
+	if node.Kind != yaml.ScalarNode || !strings.Contains(node.Value, "${") {
+		return
+	}
+	var b strings.Builder
+	raw := node.Value
+	for i := 0; i < len(raw); {
+		rest := raw[i:]
+		if strings.HasPrefix(rest, "$$") {
+			b.WriteString("$$")
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(rest, "${") {
+			if end := strings.IndexByte(rest, '}'); end > 0 {
+				if value, ok := params[rest[2:end]]; ok {
+					b.WriteString(strings.ReplaceAll(value, "$", "$$"))
+					i += end + 1
+					continue
+				}
+			}
+		}
+		b.WriteByte(raw[i])
+		i++
+	}
+	if value := b.String(); value != raw {
+		// Let the decoder resolve the type again, e.g. for a port.
+		node.Value, node.Tag = value, ""
+	}
+}
+
+// parameterizePorts replaces the ports of loopback upstreams below a
+// project node with parameters named after their route, such as API_PORT
+// for /api. Upstreams sharing a port share the parameter.
+func parameterizePorts(project *yaml.Node) []Param {
+	var params []Param
+	byPort := map[string]string{}
+	taken := map[string]bool{}
+	_, routes := mappingValue(project, "routes")
+	if routes == nil {
+		return nil
+	}
+	for _, route := range routes.Content {
+		routePath := "/"
+		if _, p := mappingValue(route, "path"); p != nil {
+			routePath = p.Value
+		}
+		var targets []*yaml.Node
+		if _, u := mappingValue(route, "upstream"); u != nil {
+			targets = append(targets, u)
+		}
+		if _, us := mappingValue(route, "upstreams"); us != nil {
+			targets = append(targets, us.Content...)
+		}
+		for _, target := range targets {
+			u, err := url.Parse(target.Value)
+			if err != nil || u.Port() == "" || !isLoopbackHost(u.Hostname()) {
+				continue
+			}
+			port := u.Port()
+			name, ok := byPort[port]
+			if !ok {
+				name = portParamName(routePath, taken)
+				byPort[port] = name
+				params = append(params, Param{
+					Name:        name,
+					Default:     port,
+					Description: "port of the upstream for " + routePath,
+				})
+			}
+			// Edit the text, since url.URL.String would escape the placeholder.
+			placeholder := net.JoinHostPort(u.Hostname(), "${"+name+"}")
+			target.Value = strings.Replace(target.Value, u.Host, placeholder, 1)
+		}
+	}
+	return params
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// portParamName derives a parameter name from a route path: PORT for /,
+// API_PORT for /api and API_V2_PORT for /api/v2.
+func portParamName(routePath string, taken map[string]bool) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(strings.Trim(routePath, "/")) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	base := "PORT"
+	if b.Len() > 0 {
+		base = strings.Trim(b.String(), "_") + "_PORT"
+		if base[0] >= '0' && base[0] <= '9' {
+			base = "P" + base
+		}
+	}
+	name := base
+	for i := 2; taken[name]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	taken[name] = true
+	return name
+}
+
+//go:embed templates/*.yaml
+var templateFiles embed.FS
+
+// Templates returns the built-in project templates, ordered by name.
+func Templates() ([]*Bundle, error) {
+	entries, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+	var templates []*Bundle
+	for _, entry := range entries {
+		data, err := templateFiles.ReadFile(path.Join("templates", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		b, err := ParseBundle(data)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", entry.Name(), err)
+		}
+		templates = append(templates, b)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Template returns the built-in template called name.
+func Template(name string) (*Bundle, error) {
+	templates, err := Templates()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(templates))
+	for _, t := range templates {
+		if t.Name == name {
+			return t, nil
+		}
+		names = append(names, t.Name)
+	}
+	return nil, fmt.Errorf("unknown template %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// ImportProject adds proj to cfg as name. It refuses to replace an existing
+// project unless replace is set, and to take a domain another project uses.
+func ImportProject(cfg *Config, name string, proj *Project, replace bool) error {
+	if _, ok := cfg.Projects[name]; ok && !replace {
+		return fmt.Errorf("project %s already exists; pass --replace to overwrite it", name)
+	}
+	for _, other := range projectNames(cfg.Projects) {
+		if other == name {
+			continue
+		}
+		for _, domain := range cfg.Projects[other].Domains {
+			for _, d := range proj.Domains {
+				if strings.EqualFold(d, domain) {
+					return fmt.Errorf("domain %s is already used by project %s", d, other)
+				}
+			}
+		}
+	}
+	cfg.Projects[name] = proj
+	return nil
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBundleRoundTripWithParameters(t *testing.T) {
+	cfg, err := Parse([]byte(`projects:
+  web:
+    domains: [web.localhost]
+    envFile: .env
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:5173
+        websocket: true
+      - path: /api
+        upstreams: ["http://localhost:8080", "http://[::1]:8081", "http://127.0.0.1:5173/x"]
+        command:
+          cmd: go run . -addr ${API_ADDR}
+      - path: /remote
+        upstream: http://api.example.com:9000
+      - path: /env
+        upstream: http://127.0.0.1:${ENV_PORT:-7000}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBundle("web", cfg.Projects["web"], true)
+	if err != nil {
+		t.Fatalf("NewBundle returned error: %v", err)
+	}
+	data, err := b.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	for _, want := range []string{"http://127.0.0.1:${PORT}", "http://localhost:${API_PORT}", "http://[::1]:${API_PORT_2}", "http://127.0.0.1:${PORT}/x", "http://api.example.com:9000", "${ENV_PORT:-7000}"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected the bundle to contain %s:\n%s", want, data)
+		}
+	}
+
+	parsed, err := ParseBundle(data)
+	if err != nil {
+		t.Fatalf("ParseBundle returned error: %v", err)
+	}
+	var names []string
+	for _, p := range parsed.Params {
+		names = append(names, p.Name+"="+p.Default)
+	}
+	if got := strings.Join(names, " "); got != "PORT=5173 API_PORT=8080 API_PORT_2=8081" {
+		t.Fatalf("unexpected parameters %s", got)
+	}
+	proj, err := parsed.Expand(map[string]string{"API_PORT": "9090"})
+	if err != nil {
+		t.Fatalf("Expand returned error: %v", err)
+	}
+	if got := proj.Routes[0].Upstream; got != "http://127.0.0.1:5173" {
+		t.Errorf("expected the default port, got %s", got)
+	}
+	if got := proj.Routes[1].Upstreams[0]; got != "http://localhost:9090" {
+		t.Errorf("expected the given port, got %s", got)
+	}
+	if got := proj.Routes[1].Command.Cmd; got != "go run . -addr ${API_ADDR}" {
+		t.Errorf("expected environment references to be kept, got %s", got)
+	}
+	if proj.EnvFile != ".env" || proj.Domains[0] != "web.localhost" || !proj.Routes[0].Websocket {
+		t.Errorf("expected the project settings to be kept, got %+v", proj)
+	}
+
+	if _, err := parsed.Expand(map[string]string{"NOPE": "1"}); err == nil {
+		t.Error("expected an error for an undeclared parameter")
+	}
+}
+
+func TestBundleExpandsParametersInTypedFields(t *testing.T) {
+	b, err := ParseBundle([]byte(`version: 1
+name: svc
+params:
+  - name: PORT
+project:
+  routes:
+    - path: /
+      upstream: http://127.0.0.1:${PORT}
+      command:
+        cmd: ./svc
+        ready:
+          port: ${PORT}
+`))
+	if err != nil {
+		t.Fatalf("ParseBundle returned error: %v", err)
+	}
+	if _, err := b.Expand(nil); err == nil || !strings.Contains(err.Error(), "PORT is required") {
+		t.Fatalf("expected a required parameter error, got %v", err)
+	}
+	proj, err := b.Expand(map[string]string{"PORT": "4000"})
+	if err != nil {
+		t.Fatalf("Expand returned error: %v", err)
+	}
+	if got := proj.Routes[0].Command.Ready.Port; got != 4000 {
+		t.Fatalf("expected the ready port 4000, got %d", got)
+	}
+}
+
+func TestParseBundleRejectsInvalidBundles(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown field":   "version: 1\nname: x\nproject:\n  routes: []\nextra: 1\n",
+		"project field":   "version: 1\nname: x\nproject:\n  domain: [x.localhost]\n",
+		"newer version":   "version: 9\nname: x\nproject:\n  routes: []\n",
+		"no project":      "version: 1\nname: x\n",
+		"bad param name":  "version: 1\nname: x\nparams: [{name: 1X}]\nproject:\n  routes: []\n",
+		"duplicate param": "version: 1\nname: x\nparams: [{name: A}, {name: A}]\nproject:\n  routes: []\n",
+	} {
+		b, err := ParseBundle([]byte(data))
+		if err == nil {
+			_, err = b.Expand(nil)
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTemplatesExpandToValidProjects(t *testing.T) {
+	templates, err := Templates()
+	if err != nil {
+		t.Fatalf("Templates returned error: %v", err)
+	}
+	var names []string
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name)
+		proj, err := tmpl.Expand(nil)
+		if err != nil {
+			t.Errorf("template %s: %v", tmpl.Name, err)
+			continue
+		}
+		proj.Domains = []string{"app.localhost"}
+		cfg := New()
+		cfg.Projects["app"] = proj
+		if err := Validate("", cfg); err != nil {
+			t.Errorf("template %s: %v", tmpl.Name, err)
+		}
+	}
+	if got := strings.Join(names, " "); got != "django nextjs rails vite+go" {
+		t.Fatalf("unexpected templates %s", got)
+	}
+	if _, err := Template("vite"); err == nil || !strings.Contains(err.Error(), "vite+go") {
+		t.Fatalf("expected an error listing the templates, got %v", err)
+	}
+}
+
+func TestImportProjectChecksConflicts(t *testing.T) {
+	cfg := New()
+	cfg.Projects["a"] = &Project{Domains: []string{"a.localhost"}}
+	if err := ImportProject(cfg, "a", &Project{Domains: []string{"b.localhost"}}, false); err == nil {
+		t.Error("expected an error for an existing project")
+	}
+	if err := ImportProject(cfg, "b", &Project{Domains: []string{"A.localhost"}}, false); err == nil || !strings.Contains(err.Error(), "project a") {
+		t.Errorf("expected a domain conflict naming project a, got %v", err)
+	}
+	if err := ImportProject(cfg, "a", &Project{Domains: []string{"a.localhost"}}, true); err != nil {
+		t.Errorf("expected replace to succeed, got %v", err)
+	}
+}
@@ -3,9 +3,9 @@ package config
 import (
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,22 +16,337 @@ const (
 
 // Config represents the persisted configuration.
 type Config struct {
+	// Version is the layout of the file; see CurrentVersion.
+	Version int `yaml:"version"`
+	// Include lists project files merged into the configuration: globs or
+	// directories holding a .devlink.yaml, relative to the configuration
+	// directory.
+	Include  []string            `yaml:"include,omitempty"`
+	Logging  *Logging            `yaml:"logging,omitempty"`
+	Tracing  *Tracing            `yaml:"tracing,omitempty"`
 	Projects map[string]*Project `yaml:"projects"`
+
+	// locations holds the position of each value read from the file.
+	locations map[string]Location
+}
+
+// Tracing exports OpenTelemetry spans of the gateway hop. Endpoint and
+// File may be combined.
+type Tracing struct {
+	// Endpoint is an OTLP/HTTP traces URL such as
+	// http://127.0.0.1:4318/v1/traces.
+	Endpoint string            `yaml:"endpoint,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	// File appends spans as OTLP JSON lines, relative to the configuration
+	// directory.
+	File string `yaml:"file,omitempty"`
+	// ServiceName defaults to "devlink".
+	ServiceName string `yaml:"serviceName,omitempty"`
+}
+
+// Access log formats.
+const (
+	LogFormatText     = "text"
+	LogFormatJSON     = "json"
+	LogFormatCommon   = "common"
+	LogFormatCombined = "combined"
+)
+
+// Access log outputs.
+const (
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+	LogOutputBoth   = "both"
+)
+
+// Logging configures the access log of the gateway. Requests are logged at
+// info level, client errors at warn and server errors at error, so Level
+// controls the verbosity; "off" disables the access log.
+type Logging struct {
+	Level  string `yaml:"level,omitempty"`
+	Format string `yaml:"format,omitempty"`
+	Output string `yaml:"output,omitempty"`
+	// File is the access log file for the file outputs, relative to the
+	// configuration directory. It defaults to logs/access.log in the state
+	// directory.
+	File string `yaml:"file,omitempty"`
+	// MaxSizeMB rotates the file once it grows past this size.
+	MaxSizeMB int `yaml:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated files kept; 0 keeps none. Unset
+	// keeps the default number.
+	MaxBackups *int `yaml:"maxBackups,omitempty"`
 }
 
 // Project describes a single local project environment.
 type Project struct {
 	Domains []string `yaml:"domains"`
 	Routes  []*Route `yaml:"routes"`
+	// EnvFile names a dotenv file, relative to the file defining the
+	// project, supplying variables for ${VAR} references in its values. The
+	// process environment takes precedence; a missing file is ignored.
+	EnvFile string `yaml:"envFile,omitempty"`
+	// Headers apply to every route of the project, before the route's own.
+	Headers *Headers `yaml:"headers,omitempty"`
+	// Source is the file the project was read from. It is set by Read and
+	// never saved.
+	Source string `yaml:"-"`
+	// Interpolated lists the values Read expanded, for display.
+	Interpolated []Interpolation `yaml:"-"`
+
+	// locations holds the position of each value read from the file,
+	// relative to the project.
+	locations map[string]Location
 }
 
-// Route describes a proxied route.
+// Dir returns the directory relative paths of the project are resolved
+// against: the directory of its source file, or baseDir when unknown.
+func (p *Project) Dir(baseDir string) string {
+	if p.Source == "" {
+		return baseDir
+	}
+	return filepath.Dir(p.Source)
+}
+
+// Route describes a proxied route. Instead of an upstream, a route may serve
+// the static files below Root. Relative paths of a route are resolved
+// against the directory of the file defining its project.
 type Route struct {
-	Path            string `yaml:"path"`
-	Upstream        string `yaml:"upstream"`
-	StripPathPrefix *bool  `yaml:"stripPathPrefix,omitempty"`
-	Websocket       bool   `yaml:"websocket,omitempty"`
-	SpaFallback     bool   `yaml:"spaFallback,omitempty"`
+	Path      string   `yaml:"path"`
+	Upstream  string   `yaml:"upstream,omitempty"`
+	Upstreams []string `yaml:"upstreams,omitempty"`
+	Root      string   `yaml:"root,omitempty"`
+	Index     []string `yaml:"index,omitempty"`
+	Browse    bool     `yaml:"browse,omitempty"`
+	Mock      *Mock    `yaml:"mock,omitempty"`
+	// Replay serves the responses recorded in a HAR file instead of
+	// proxying to an upstream.
+	Replay          string         `yaml:"replay,omitempty"`
+	LoadBalancing   *LoadBalancing `yaml:"loadBalancing,omitempty"`
+	HealthCheck     *HealthCheck   `yaml:"healthCheck,omitempty"`
+	Retry           *RetryPolicy   `yaml:"retry,omitempty"`
+	Command         *Command       `yaml:"command,omitempty"`
+	StripPathPrefix *bool          `yaml:"stripPathPrefix,omitempty"`
+	Websocket       bool           `yaml:"websocket,omitempty"`
+	SpaFallback     bool           `yaml:"spaFallback,omitempty"`
+	Headers         *Headers       `yaml:"headers,omitempty"`
+}
+
+// Headers rewrites the headers of requests sent to a route and of the
+// responses returned to the client, applying the rules in order.
+type Headers struct {
+	Request  []*HeaderRule `yaml:"request,omitempty"`
+	Response []*HeaderRule `yaml:"response,omitempty"`
+}
+
+// HeaderRule changes one header. Exactly one of Set, Add, Remove and Rename
+// names the header it acts on.
+type HeaderRule struct {
+	// Set replaces the header with Value.
+	Set string `yaml:"set,omitempty"`
+	// Add appends Value to the header.
+	Add string `yaml:"add,omitempty"`
+	// Remove deletes the header. A trailing * removes every header with
+	// the prefix, e.g. X-Powered-*.
+	Remove string `yaml:"remove,omitempty"`
+	// Rename moves the values of the header to To.
+	Rename string `yaml:"rename,omitempty"`
+	To     string `yaml:"to,omitempty"`
+	// Value is a Go template with access to the request, e.g.
+	// {{.ClientIP}}, {{.Route}} or {{.Label}} for the first label of the
+	// host.
+	Value string `yaml:"value,omitempty"`
+}
+
+// Clone creates a deep copy of the header rules.
+func (h *Headers) Clone() *Headers {
+	if h == nil {
+		return nil
+	}
+	return &Headers{Request: cloneRules(h.Request), Response: cloneRules(h.Response)}
+}
+
+func cloneRules(rules []*HeaderRule) []*HeaderRule {
+	var clone []*HeaderRule
+	for _, rule := range rules {
+		if rule != nil {
+			r := *rule
+			rule = &r
+		}
+		clone = append(clone, rule)
+	}
+	return clone
+}
+
+// Load balancing policies understood by the proxy.
+const (
+	PolicyRoundRobin       = "round-robin"
+	PolicyLeastConnections = "least-connections"
+	PolicyCookie           = "cookie"
+	PolicyHeader           = "header"
+)
+
+// LoadBalancing selects how requests are spread across multiple upstreams.
+type LoadBalancing struct {
+	Policy string `yaml:"policy,omitempty"`
+	// Cookie names the sticky session cookie for the cookie policy.
+	Cookie string `yaml:"cookie,omitempty"`
+	// Header names the request header hashed by the header policy.
+	Header string `yaml:"header,omitempty"`
+}
+
+// HealthCheck configures active HTTP health checks for a route's upstreams.
+type HealthCheck struct {
+	Path               string   `yaml:"path"`
+	Interval           Duration `yaml:"interval,omitempty"`
+	Timeout            Duration `yaml:"timeout,omitempty"`
+	ExpectStatus       int      `yaml:"expectStatus,omitempty"`
+	UnhealthyThreshold int      `yaml:"unhealthyThreshold,omitempty"`
+	HealthyThreshold   int      `yaml:"healthyThreshold,omitempty"`
+}
+
+// Mock serves canned responses for a route. Requests matching none of the
+// responses are proxied to the route's upstream when it has one.
+type Mock struct {
+	// Dir holds fixture files named after the request path below the route,
+	// e.g. users/42.json or users.POST.json. Relative to the config file.
+	Dir       string          `yaml:"dir,omitempty"`
+	Responses []*MockResponse `yaml:"responses,omitempty"`
+}
+
+// MockResponse is a canned response and the requests it answers. Body and
+// BodyFile are Go templates with access to the request.
+type MockResponse struct {
+	Match    MockMatch         `yaml:"match,omitempty"`
+	Status   int               `yaml:"status,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Body     string            `yaml:"body,omitempty"`
+	BodyFile string            `yaml:"bodyFile,omitempty"`
+	Latency  Duration          `yaml:"latency,omitempty"`
+}
+
+// MockMatch selects requests. Path is matched against the full request path
+// and may contain {name} captures, * for one segment and a trailing **.
+type MockMatch struct {
+	Method  string            `yaml:"method,omitempty"`
+	Path    string            `yaml:"path,omitempty"`
+	Query   map[string]string `yaml:"query,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// RetryPolicy holds idempotent requests while the upstream refuses
+// connections, for example during a dev server restart, and replays them once
+// it accepts connections again.
+type RetryPolicy struct {
+	// Timeout bounds how long a request is held before failing.
+	Timeout Duration `yaml:"timeout,omitempty"`
+	// Interval is the delay between connection attempts.
+	Interval Duration `yaml:"interval,omitempty"`
+	// MaxBodyBytes is the largest request body buffered for replay. Requests
+	// with larger bodies are not retried.
+	MaxBodyBytes int64 `yaml:"maxBodyBytes,omitempty"`
+}
+
+// Command describes the dev server process serving a route, started by
+// `devlink up`.
+type Command struct {
+	// Cmd is run through the platform shell, which expands its variables,
+	// so it is not interpolated.
+	Cmd string `yaml:"cmd" interpolate:"-"`
+	// Cwd is resolved relative to the configuration file.
+	Cwd   string            `yaml:"cwd,omitempty"`
+	Env   map[string]string `yaml:"env,omitempty"`
+	Ready *ReadyProbe       `yaml:"ready,omitempty"`
+	// AutoPort allocates a free loopback port for the process and rewrites
+	// the route's upstream to it. The assignment is persisted in the state
+	// directory so URLs stay stable across restarts.
+	AutoPort bool `yaml:"autoPort,omitempty"`
+	// PortEnv names the environment variable receiving the allocated port.
+	PortEnv string `yaml:"portEnv,omitempty"`
+}
+
+// DefaultPortEnv is the variable receiving an allocated port when PortEnv is
+// not set.
+const DefaultPortEnv = "PORT"
+
+// ReadyProbe decides when a supervised process may receive traffic. By
+// default the route's upstream address is probed for accepted connections.
+type ReadyProbe struct {
+	// Port overrides the probed loopback port.
+	Port int `yaml:"port,omitempty"`
+	// Path switches to an HTTP probe that expects a non-5xx response.
+	Path     string   `yaml:"path,omitempty"`
+	Interval Duration `yaml:"interval,omitempty"`
+}
+
+// Targets returns every upstream configured for the route, starting with the
+// single upstream field when present.
+func (r *Route) Targets() []string {
+	var targets []string
+	if r.Upstream != "" {
+		targets = append(targets, r.Upstream)
+	}
+	return append(targets, r.Upstreams...)
+}
+
+// Clone creates a deep copy of the route.
+func (r *Route) Clone() *Route {
+	clone := *r
+	clone.Upstreams = append([]string(nil), r.Upstreams...)
+	clone.Index = append([]string(nil), r.Index...)
+	if r.StripPathPrefix != nil {
+		strip := *r.StripPathPrefix
+		clone.StripPathPrefix = &strip
+	}
+	if r.LoadBalancing != nil {
+		lb := *r.LoadBalancing
+		clone.LoadBalancing = &lb
+	}
+	if r.HealthCheck != nil {
+		hc := *r.HealthCheck
+		clone.HealthCheck = &hc
+	}
+	if r.Retry != nil {
+		retry := *r.Retry
+		clone.Retry = &retry
+	}
+	if r.Mock != nil {
+		clone.Mock = r.Mock.Clone()
+	}
+	if r.Command != nil {
+		cmd := *r.Command
+		cmd.Env = cloneStringMap(r.Command.Env)
+		if r.Command.Ready != nil {
+			ready := *r.Command.Ready
+			cmd.Ready = &ready
+		}
+		clone.Command = &cmd
+	}
+	clone.Headers = r.Headers.Clone()
+	return &clone
+}
+
+// Clone creates a deep copy of the mock definition.
+func (m *Mock) Clone() *Mock {
+	clone := &Mock{Dir: m.Dir}
+	for _, resp := range m.Responses {
+		c := *resp
+		c.Headers = cloneStringMap(resp.Headers)
+		c.Match.Query = cloneStringMap(resp.Match.Query)
+		c.Match.Headers = cloneStringMap(resp.Match.Headers)
+		clone.Responses = append(clone.Responses, &c)
+	}
+	return clone
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
 }
 
 // New creates a default configuration instance.
@@ -47,32 +362,66 @@ func (c *Config) Clone() *Config {
 		return nil
 	}
 	clone := New()
+	clone.Version = c.Version
+	clone.locations = c.locations
+	clone.Include = append([]string(nil), c.Include...)
+	if c.Logging != nil {
+		logging := *c.Logging
+		if c.Logging.MaxBackups != nil {
+			backups := *c.Logging.MaxBackups
+			logging.MaxBackups = &backups
+		}
+		clone.Logging = &logging
+	}
+	if c.Tracing != nil {
+		tracing := *c.Tracing
+		tracing.Headers = cloneStringMap(c.Tracing.Headers)
+		clone.Tracing = &tracing
+	}
 	for name, proj := range c.Projects {
 		cloneProj := &Project{
-			Domains: append([]string{}, proj.Domains...),
+			Domains:      append([]string{}, proj.Domains...),
+			EnvFile:      proj.EnvFile,
+			Headers:      proj.Headers.Clone(),
+			Source:       proj.Source,
+			Interpolated: append([]Interpolation(nil), proj.Interpolated...),
+			locations:    proj.locations,
 		}
 		for _, route := range proj.Routes {
-			cloneRoute := *route
-			cloneProj.Routes = append(cloneProj.Routes, &cloneRoute)
+			cloneProj.Routes = append(cloneProj.Routes, route.Clone())
 		}
 		clone.Projects[name] = cloneProj
 	}
 	return clone
 }
 
-// Load reads a configuration from disk. If the file does not exist a new
-// configuration is returned.
+// Load reads a configuration from disk merged with the project files it
+// includes. If the file does not exist a new configuration is returned. Use
+// LoadRevision for the content of the file alone, e.g. to edit it.
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	snap, err := Read(path)
 	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
-			return New(), nil
-		}
-		return nil, fmt.Errorf("read config: %w", err)
+		return nil, err
 	}
+	return snap.Config, nil
+}
+
+// Parse decodes a configuration from YAML, upgrading older layouts to
+// CurrentVersion. Unknown fields are rejected with their line numbers.
+func Parse(data []byte) (*Config, error) {
 	cfg := New()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("unmarshal config: %w", err)
+	doc, _, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) > 0 {
+		if err := checkFields(doc.Content[0], reflect.TypeOf(Config{}), ""); err != nil {
+			return nil, err
+		}
+		if err := doc.Content[0].Decode(cfg); err != nil {
+			return nil, fmt.Errorf("unmarshal config: %w", err)
+		}
+		attachLocations(doc.Content[0], cfg)
 	}
 	if cfg.Projects == nil {
 		cfg.Projects = map[string]*Project{}
@@ -80,8 +429,8 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
-// Save writes the configuration to disk, creating parent directories if
-// necessary.
+// Save writes the configuration to disk atomically, creating parent
+// directories if necessary.
 func Save(path string, cfg *Config) error {
 	if cfg == nil {
 		return errors.New("config is nil")
@@ -89,11 +438,38 @@ func Save(path string, cfg *Config) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return fmt.Errorf("create config dir: %w", err)
 	}
-	data, err := yaml.Marshal(cfg)
+	out := *cfg
+	out.Version = CurrentVersion
+	data, err := yaml.Marshal(&out)
 	if err != nil {
 		return fmt.Errorf("marshal config: %w", err)
 	}
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+	return writeAtomic(path, data)
+}
+
+// writeAtomic replaces path with data through a temporary file in the same
+// directory, so readers never see a partially written file.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
 		return fmt.Errorf("write config: %w", err)
 	}
 	return nil
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrConflict is returned by Edit when the configuration file changed while
+// it was being edited, for example by a text editor that does not take the
+// lock.
+var ErrConflict = errors.New("configuration file changed during the edit; retry")
+
+// Revision identifies the content of a configuration file. A missing file
+// has the empty revision.
+type Revision string
+
+// ReadRevision returns the revision of the file at path.
+func ReadRevision(path string) (Revision, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read config: %w", err)
+	}
+	return revisionOf(data), nil
+}
+
+func revisionOf(data []byte) Revision {
+	sum := sha256.Sum256(data)
+	return Revision(hex.EncodeToString(sum[:]))
+}
+
+// LoadRevision reads a configuration together with its revision.
+func LoadRevision(path string) (*Config, Revision, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New(), "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("read config: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, revisionOf(data), nil
+}
+
+// SaveIfUnchanged saves cfg unless the file no longer has revision rev, in
+// which case it returns ErrConflict.
+func SaveIfUnchanged(path string, cfg *Config, rev Revision) error {
+	current, err := ReadRevision(path)
+	if err != nil {
+		return err
+	}
+	if current != rev {
+		return ErrConflict
+	}
+	return Save(path, cfg)
+}
+
+// Edit loads the configuration at path, applies fn and saves the result
+// while holding an advisory lock, so concurrent edits through Edit are
+// serialized. The result, merged with its included files, must pass
+// Validate. Changes made without the lock are detected and reported as
+// ErrConflict instead of being overwritten.
+func Edit(path string, fn func(cfg *Config) error) error {
+	unlock, err := Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cfg, rev, err := LoadRevision(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	cfg.forgetLocations()
+	merged, err := Resolve(path, cfg)
+	if err != nil {
+		return err
+	}
+	if err := Validate(path, merged); err != nil {
+		return err
+	}
+	return SaveIfUnchanged(path, cfg, rev)
+}
+
+// Lock takes an exclusive advisory lock for the configuration at path and
+// returns the function releasing it. The lock is held on a separate file
+// because saving replaces the configuration file itself.
+func Lock(path string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create config dir: %w", err)
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("lock config: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock config: %w", err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestEditSerializesConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- Edit(path, func(cfg *Config) error {
+				name := fmt.Sprintf("p%d", i)
+				cfg.Projects[name] = &Project{
+					Domains: []string{name + ".localhost"},
+					Routes:  []*Route{{Path: "/", Upstream: "http://127.0.0.1:3000"}},
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Edit returned error: %v", err)
+		}
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Projects) != 20 {
+		t.Fatalf("expected 20 projects, got %d", len(cfg.Projects))
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	if len(leftovers) != 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestEditDetectsUnlockedChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	if err := Save(path, New()); err != nil {
+		t.Fatal(err)
+	}
+	err := Edit(path, func(cfg *Config) error {
+		// An editor saving without taking the lock.
+		return os.WriteFile(path, []byte("projects: {}\n# edited\n"), 0o644)
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "projects: {}\n# edited\n" {
+		t.Fatalf("expected the concurrent change to be kept, got %q", data)
+	}
+}
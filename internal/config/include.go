@@ -0,0 +1,248 @@
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProjectFileName is the per-repository project file. It holds a projects
+// map like the global configuration and is registered with `devlink link`.
+const ProjectFileName = ".devlink.yaml"
+
+// Snapshot is a configuration merged with the project files it includes.
+type Snapshot struct {
+	Config *Config
+	// Files lists the files read, starting with the configuration file.
+	Files []string
+	// Digest fingerprints the content of Files, so a watcher can tell
+	// whether reading again would see anything new.
+	Digest [sha256.Size]byte
+	// patterns are the include entries as absolute globs.
+	patterns []string
+}
+
+// Read loads the configuration at path and merges the project files it
+// includes. Every project records the file it came from in Source. Files and
+// Digest are set even when an error is returned, covering what was read.
+func Read(path string) (*Snapshot, error) {
+	snap := &Snapshot{Files: []string{path}}
+	h := sha256.New()
+	defer func() { copy(snap.Digest[:], h.Sum(nil)) }()
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return snap, fmt.Errorf("read config: %w", err)
+	}
+	writeDigest(h, path, data)
+	cfg, err := Parse(data)
+	if err != nil {
+		return snap, err
+	}
+	return snap, snap.include(path, cfg, h)
+}
+
+// Resolve merges the project files included by cfg, the configuration
+// stored at path, into a copy of cfg. It reports the errors Read would.
+func Resolve(path string, cfg *Config) (*Config, error) {
+	snap := &Snapshot{Files: []string{path}}
+	err := snap.include(path, cfg.Clone(), sha256.New())
+	return snap.Config, err
+}
+
+func (s *Snapshot) include(path string, cfg *Config, h hash.Hash) error {
+	if err := interpolateSettings(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.loadProjects(path, cfg.Projects, h); err != nil {
+		return err
+	}
+	files, patterns, err := includedFiles(cfg.Include, filepath.Dir(path))
+	s.patterns = patterns
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the glob matched; the watcher triggers another read.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file, err)
+		}
+		s.Files = append(s.Files, file)
+		writeDigest(h, file, data)
+		included, err := Parse(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if len(included.Include) > 0 || included.Logging != nil || included.Tracing != nil {
+			return fmt.Errorf("%s: project files may only define projects", file)
+		}
+		if err := s.loadProjects(file, included.Projects, h); err != nil {
+			return err
+		}
+		if err := mergeProjects(cfg, file, included); err != nil {
+			return err
+		}
+	}
+	s.Config = cfg
+	return nil
+}
+
+// loadProjects records the source file of projects and interpolates their
+// values, reading the env files they name.
+func (s *Snapshot) loadProjects(file string, projects map[string]*Project, h hash.Hash) error {
+	for _, name := range projectNames(projects) {
+		proj := projects[name]
+		if proj == nil {
+			return fmt.Errorf("project %s in %s is empty", name, file)
+		}
+		proj.Source = file
+		if err := s.interpolateProject(proj, h); err != nil {
+			return fmt.Errorf("project %s in %s: %w", name, file, err)
+		}
+	}
+	return nil
+}
+
+func projectNames(projects map[string]*Project) []string {
+	names := make([]string, 0, len(projects))
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeDigest adds a file to the digest, delimited so that moving content
+// between files changes the result.
+func writeDigest(h hash.Hash, path string, data []byte) {
+	h.Write([]byte(path + "\x00" + strconv.Itoa(len(data)) + "\x00"))
+	h.Write(data)
+}
+
+// includedFiles expands include entries into the project files they name,
+// in entry order. Entries are globs; a match that is a directory stands for
+// the project file inside it. Relative entries are resolved against baseDir.
+func includedFiles(entries []string, baseDir string) (files, patterns []string, err error) {
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		pattern := IncludePath(entry, baseDir)
+		patterns = append(patterns, pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, patterns, fmt.Errorf("include %s: %w", entry, err)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				match = filepath.Join(match, ProjectFileName)
+				if _, err := os.Stat(match); err != nil {
+					continue
+				}
+			}
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, patterns, nil
+}
+
+// IncludePath returns the absolute form of an include entry, expanding a
+// leading ~ to the home directory.
+func IncludePath(entry, baseDir string) string {
+	if entry == "~" || strings.HasPrefix(entry, "~/") || strings.HasPrefix(entry, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			entry = filepath.Join(home, entry[1:])
+		}
+	}
+	if !filepath.IsAbs(entry) {
+		entry = filepath.Join(baseDir, entry)
+	}
+	return filepath.Clean(entry)
+}
+
+func mergeProjects(cfg *Config, file string, included *Config) error {
+	for _, name := range projectNames(included.Projects) {
+		proj := included.Projects[name]
+		if existing, ok := cfg.Projects[name]; ok {
+			return fmt.Errorf("project %s in %s is already defined in %s", name, file, existing.Source)
+		}
+		cfg.Projects[name] = proj
+	}
+	return nil
+}
+
+// Relevant reports whether a change to the named file may alter what Read
+// returns: it is one of Files or may match an include entry.
+func (s *Snapshot) Relevant(name string) bool {
+	name = filepath.Clean(name)
+	for _, file := range s.Files {
+		if name == filepath.Clean(file) {
+			return true
+		}
+	}
+	for _, pattern := range s.patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(filepath.Join(pattern, ProjectFileName), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchDirs returns the existing directories holding Files or the files an
+// include entry could match, for a directory watcher.
+func (s *Snapshot) WatchDirs() []string {
+	seen := map[string]bool{}
+	var dirs []string
+	add := func(dir string) {
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, file := range s.Files {
+		add(filepath.Dir(file))
+	}
+	for _, pattern := range s.patterns {
+		add(staticDir(pattern))
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			add(match)
+		}
+	}
+	return dirs
+}
+
+// staticDir returns the deepest directory of pattern without glob
+// metacharacters.
+func staticDir(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for strings.ContainsAny(dir, "*?[") {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return dir
+}
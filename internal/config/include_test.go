@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadMergesIncludedProjectFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	writeFile(t, path, "include: [repos/*, extra/other.yaml]\nprojects:\n  main:\n    domains: [main.localhost]\n")
+	writeFile(t, filepath.Join(dir, "repos", "a", ProjectFileName), "projects:\n  a:\n    domains: [a.localhost]\n")
+	writeFile(t, filepath.Join(dir, "repos", "b", "README"), "not a project")
+	writeFile(t, filepath.Join(dir, "extra", "other.yaml"), "projects:\n  other:\n    domains: [other.localhost]\n")
+
+	snap, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	want := map[string]string{
+		"main":  path,
+		"a":     filepath.Join(dir, "repos", "a", ProjectFileName),
+		"other": filepath.Join(dir, "extra", "other.yaml"),
+	}
+	if len(snap.Config.Projects) != len(want) {
+		t.Fatalf("expected %d projects, got %v", len(want), snap.Config.Projects)
+	}
+	for name, source := range want {
+		if got := snap.Config.Projects[name].Source; got != source {
+			t.Errorf("project %s: expected source %s, got %s", name, source, got)
+		}
+	}
+	if len(snap.Files) != 3 {
+		t.Fatalf("expected 3 files, got %v", snap.Files)
+	}
+	if !snap.Relevant(filepath.Join(dir, "repos", "new", ProjectFileName)) {
+		t.Error("expected a project file in a new repository to be relevant")
+	}
+	if snap.Relevant(filepath.Join(dir, "repos", "b", "README")) {
+		t.Error("expected unrelated files not to be relevant")
+	}
+
+	before := snap.Digest
+	writeFile(t, filepath.Join(dir, "repos", "a", ProjectFileName), "projects:\n  a:\n    domains: [a2.localhost]\n")
+	snap, err = Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Digest == before {
+		t.Error("expected a changed project file to change the digest")
+	}
+}
+
+func TestIncludeConflictsAreReported(t *testing.T) {
+	cases := map[string]struct {
+		included string
+		want     string
+	}{
+		"project name": {"projects:\n  main:\n    domains: [other.localhost]\n", "project main in"},
+		"domain":       {"projects:\n  repo:\n    domains: [MAIN.localhost]\n", "domain MAIN.localhost"},
+		"settings":     {"logging:\n  level: debug\n", "may only define projects"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "devlink.yaml")
+			writeFile(t, path, "include: [repo]\nprojects:\n  main:\n    domains: [main.localhost]\n")
+			writeFile(t, filepath.Join(dir, "repo", ProjectFileName), tc.included)
+			snap, err := Read(path)
+			if err == nil {
+				err = Validate(path, snap.Config)
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsIncludedProjectsOut(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	writeFile(t, path, "include: [repo]\nprojects: {}\n")
+	writeFile(t, filepath.Join(dir, "repo", ProjectFileName), "projects:\n  repo:\n    domains: [repo.localhost]\n    routes:\n      - path: /\n        root: ./public\n")
+	err := Edit(path, func(cfg *Config) error {
+		cfg.Projects["main"] = &Project{
+			Domains: []string{"main.localhost"},
+			Routes:  []*Route{{Path: "/", Upstream: "http://127.0.0.1:3000"}},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "repo.localhost") {
+		t.Fatalf("expected included projects not to be saved, got:\n%s", data)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Projects) != 2 {
+		t.Fatalf("expected both projects after loading, got %v", cfg.Projects)
+	}
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Variable sources other than env files.
+const (
+	SourceEnvironment = "environment"
+	SourceDefault     = "default"
+)
+
+// Interpolation records a project value that referenced variables.
+type Interpolation struct {
+	// Field is the YAML path of the value within its project, such as
+	// routes[0].upstream.
+	Field string
+	Raw   string
+	Value string
+	Vars  []Variable
+}
+
+// Variable is a variable referenced by a value and where its value came
+// from: the process environment, an env file or the default.
+type Variable struct {
+	Name   string
+	Source string
+}
+
+// lookupFunc resolves a variable, reporting where its value came from.
+type lookupFunc func(name string) (value, source string, ok bool)
+
+func lookupEnvironment(name string) (string, string, bool) {
+	value, ok := os.LookupEnv(name)
+	return value, SourceEnvironment, ok
+}
+
+// interpolateSettings expands the settings outside projects against the
+// process environment.
+func interpolateSettings(cfg *Config) error {
+	for i, entry := range cfg.Include {
+		value, _, err := expand(entry, lookupEnvironment)
+		if err != nil {
+			return fmt.Errorf("include[%d]: %w", i, err)
+		}
+		cfg.Include[i] = value
+	}
+	if err := interpolateValue(reflect.ValueOf(cfg.Logging), "logging", lookupEnvironment, nil); err != nil {
+		return err
+	}
+	return interpolateValue(reflect.ValueOf(cfg.Tracing), "tracing", lookupEnvironment, nil)
+}
+
+// interpolateProject expands the string values of proj. Variables are looked
+// up in the process environment first and then in the project's env file,
+// which may be missing.
+func (s *Snapshot) interpolateProject(proj *Project, h hash.Hash) error {
+	proj.Interpolated = nil
+	lookup := lookupEnvironment
+	if proj.EnvFile != "" {
+		file := proj.EnvFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(proj.Dir("."), file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read env file: %w", err)
+		}
+		// Watched even while missing, so creating it triggers a reload.
+		s.Files = append(s.Files, file)
+		writeDigest(h, file, data)
+		vars, err := parseEnvFile(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		lookup = func(name string) (string, string, bool) {
+			if value, ok := os.LookupEnv(name); ok {
+				return value, SourceEnvironment, true
+			}
+			value, ok := vars[name]
+			return value, file, ok
+		}
+	}
+	return interpolateValue(reflect.ValueOf(proj).Elem(), "", lookup, func(i Interpolation) {
+		proj.Interpolated = append(proj.Interpolated, i)
+	})
+}
+
+// interpolateValue walks v and expands every string, string slice element
+// and string map value in place, except in fields tagged interpolate:"-".
+// Fields are named after their YAML keys.
+func interpolateValue(v reflect.Value, field string, lookup lookupFunc, record func(Interpolation)) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return interpolateValue(v.Elem(), field, lookup, record)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if !f.IsExported() || name == "-" || f.Tag.Get("interpolate") == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			if field != "" {
+				name = field + "." + name
+			}
+			if err := interpolateValue(v.Field(i), name, lookup, record); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := interpolateValue(v.Index(i), fmt.Sprintf("%s[%d]", field, i), lookup, record); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			key := reflect.ValueOf(k).Convert(v.Type().Key())
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := interpolateValue(elem, field+"."+k, lookup, record); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.String:
+		raw := v.String()
+		if !strings.Contains(raw, "$") {
+			return nil
+		}
+		value, vars, err := expand(raw, lookup)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		v.SetString(value)
+		if record != nil && len(vars) > 0 {
+			record(Interpolation{Field: field, Raw: raw, Value: value, Vars: vars})
+		}
+	}
+	return nil
+}
+
+// expand replaces ${VAR} and ${VAR:-default} references in raw. The default
+// applies when the variable is unset or empty, and $$ stands for a literal
+// dollar sign. Referencing an unset variable without a default is an error.
+func expand(raw string, lookup lookupFunc) (string, []Variable, error) {
+	var b strings.Builder
+	var vars []Variable
+	for i := 0; i < len(raw); {
+		rest := raw[i:]
+		switch {
+		case strings.HasPrefix(rest, "$$"):
+			b.WriteByte('$')
+			i += 2
+			continue
+		case !strings.HasPrefix(rest, "${"):
+			b.WriteByte(raw[i])
+			i++
+			continue
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated ${ in %q", raw)
+		}
+		name, def, hasDefault := strings.Cut(rest[2:end], ":-")
+		if !validVariableName(name) {
+			return "", nil, fmt.Errorf("invalid variable name %q in %q", name, raw)
+		}
+		value, source, ok := lookup(name)
+		if !ok || (value == "" && hasDefault) {
+			if !hasDefault {
+				return "", nil, fmt.Errorf("variable %s is not set", name)
+			}
+			value, source = def, SourceDefault
+		}
+		vars = append(vars, Variable{Name: name, Source: source})
+		b.WriteString(value)
+		i += end + 1
+	}
+	return b.String(), vars, nil
+}
+
+func validVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseEnvFile reads KEY=VALUE lines. Blank lines, # comments and a leading
+// export are allowed; values may be single or double quoted, and double
+// quoted values understand \n, \" and \\.
+func parseEnvFile(data []byte) (map[string]string, error) {
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validVariableName(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		value, err := envValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
+
+func envValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		inner := value[1:end]
+		if quote == '"' {
+			inner = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(inner)
+		}
+		return inner, nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"PORT": "5173", "EMPTY": ""}
+	lookup := func(name string) (string, string, bool) {
+		value, ok := vars[name]
+		return value, "test", ok
+	}
+	cases := []struct {
+		raw, want, err string
+	}{
+		{raw: "http://127.0.0.1:${PORT}", want: "http://127.0.0.1:5173"},
+		{raw: "${MISSING:-8080}", want: "8080"},
+		{raw: "${EMPTY:-fallback}", want: "fallback"},
+		{raw: "[${EMPTY}]", want: "[]"},
+		{raw: "$$PORT and $${PORT} and $PORT", want: "$PORT and ${PORT} and $PORT"},
+		{raw: "${MISSING}", err: "variable MISSING is not set"},
+		{raw: "${PORT", err: "unterminated"},
+		{raw: "${1X}", err: "invalid variable name"},
+	}
+	for _, tc := range cases {
+		got, _, err := expand(tc.raw, lookup)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expand(%q): expected error %q, got %v", tc.raw, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("expand(%q) = %q, %v; want %q", tc.raw, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	vars, err := parseEnvFile([]byte("# ports\nexport WEB_PORT=3000\nAPI_PORT = 8080 # backend\nNAME='a b'\nMULTI=\"x\\ny\"\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"WEB_PORT": "3000", "API_PORT": "8080", "NAME": "a b", "MULTI": "x\ny"}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+	if _, err := parseEnvFile([]byte("A=1\nnot a pair\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a line error, got %v", err)
+	}
+}
+
+func TestReadInterpolatesProjectsWithEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	raw := "projects:\n  web:\n    envFile: .env\n    domains: [web.localhost]\n    routes:\n" +
+		"      - path: /\n        upstream: http://127.0.0.1:${WEB_PORT:-5173}\n" +
+		"      - path: /api\n        upstream: http://${API_HOST}:${API_PORT:-8080}\n" +
+		"        command:\n          cmd: serve --port ${PORT}\n"
+	writeFile(t, path, raw)
+	writeFile(t, filepath.Join(dir, ".env"), "WEB_PORT=3000\nAPI_HOST=ignored\n")
+	t.Setenv("API_HOST", "127.0.0.2")
+
+	snap, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	proj := snap.Config.Projects["web"]
+	if got := proj.Routes[0].Upstream; got != "http://127.0.0.1:3000" {
+		t.Errorf("expected the env file value, got %s", got)
+	}
+	if got := proj.Routes[1].Upstream; got != "http://127.0.0.2:8080" {
+		t.Errorf("expected the environment to win over the env file, got %s", got)
+	}
+	if got := proj.Routes[1].Command.Cmd; got != "serve --port ${PORT}" {
+		t.Errorf("expected commands to be left to the shell, got %s", got)
+	}
+	if len(proj.Interpolated) != 2 || proj.Interpolated[1].Field != "routes[1].upstream" {
+		t.Fatalf("unexpected interpolations: %+v", proj.Interpolated)
+	}
+	sources := proj.Interpolated[1].Vars
+	if sources[0].Source != SourceEnvironment || sources[1].Source != SourceDefault {
+		t.Errorf("unexpected variable sources: %+v", sources)
+	}
+
+	before := snap.Digest
+	writeFile(t, filepath.Join(dir, ".env"), "WEB_PORT=3001\n")
+	snap, err = Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Digest == before {
+		t.Error("expected a changed env file to change the digest")
+	}
+	if got := snap.Config.Projects["web"].Routes[0].Upstream; got != "http://127.0.0.1:3001" {
+		t.Errorf("expected the new env file value, got %s", got)
+	}
+
+	if err := Edit(path, func(cfg *Config) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "${WEB_PORT:-5173}") {
+		t.Fatalf("expected raw values to be saved, got:\n%s", data)
+	}
+}
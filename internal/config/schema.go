@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SchemaID identifies the JSON Schema emitted by Schema.
+const SchemaID = "https://devlink.localhost/schema/devlink.json"
+
+// schemaEnums lists the accepted values of string fields, keyed by
+// Type.Field.
+var schemaEnums = map[string][]string{
+	"LoadBalancing.Policy": {PolicyRoundRobin, PolicyLeastConnections, PolicyCookie, PolicyHeader},
+	"Logging.Level":        {"debug", "info", "warn", "error", "off"},
+	"Logging.Format":       {LogFormatText, LogFormatJSON, LogFormatCommon, LogFormatCombined},
+	"Logging.Output":       {LogOutputStderr, LogOutputFile, LogOutputBoth},
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// Schema returns a JSON Schema (draft 2020-12) describing the configuration
+// file, derived from the Config type, for editors to validate and complete
+// devlink.yaml and .devlink.yaml files.
+func Schema() ([]byte, error) {
+	defs := map[string]any{}
+	root := schemaFor(reflect.TypeOf(Config{}), defs)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = SchemaID
+	root["title"] = "devlink configuration"
+	root["$defs"] = defs
+	props := root["properties"].(map[string]any)
+	props["version"] = map[string]any{"type": "integer", "minimum": 0, "maximum": CurrentVersion}
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaFor describes t. Named structs other than Config are added to defs
+// once and referenced.
+func schemaFor(t reflect.Type, defs map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return map[string]any{
+			"type":        "string",
+			"pattern":     `^(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`,
+			"description": "Go duration such as 500ms or 1m30s",
+		}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "Config" {
+			return structSchema(t, defs)
+		}
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // reserve against recursion
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	props := map[string]any{}
+	for name, f := range yamlFields(t) {
+		prop := schemaFor(f.Type, defs)
+		if values, ok := schemaEnums[t.Name()+"."+f.Name]; ok {
+			prop["enum"] = values
+		}
+		props[name] = prop
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,468 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReservedDomain is served by devlink itself (the traffic inspector) and
+// cannot be assigned to a project.
+const ReservedDomain = "devlink.localhost"
+
+// Location is a position in a configuration file. Line and Column are zero
+// when the value was not read from the file, e.g. during a CLI edit.
+type Location struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (l Location) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// Problem is a single validation finding.
+type Problem struct {
+	Location Location
+	// Path is the YAML path of the offending value, such as
+	// projects.web.routes[0].path.
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Location, p.Path, p.Message)
+}
+
+// ValidationError lists every problem found by Validate.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indexLocations records the position of every value below node, keyed by
+// its path. Mapping values are located at their key.
+func indexLocations(node *yaml.Node, prefix string, into map[string]Location) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			p := joinPath(prefix, key.Value)
+			into[p] = Location{Line: key.Line, Column: key.Column}
+			indexLocations(node.Content[i+1], p, into)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			p := fmt.Sprintf("%s[%d]", prefix, i)
+			into[p] = Location{Line: item.Line, Column: item.Column}
+			indexLocations(item, p, into)
+		}
+	}
+}
+
+// attachLocations indexes the decoded document root for cfg and its
+// projects, whose paths are kept relative to the project.
+func attachLocations(root *yaml.Node, cfg *Config) {
+	cfg.locations = map[string]Location{}
+	indexLocations(root, "", cfg.locations)
+	_, projects := mappingValue(root, "projects")
+	if projects == nil || projects.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(projects.Content); i += 2 {
+		key := projects.Content[i]
+		proj := cfg.Projects[key.Value]
+		if proj == nil {
+			continue
+		}
+		proj.locations = map[string]Location{"": {Line: key.Line, Column: key.Column}}
+		indexLocations(projects.Content[i+1], "", proj.locations)
+	}
+}
+
+// forgetLocations drops the positions read from the file, which no longer
+// match once the configuration is edited in memory.
+func (c *Config) forgetLocations() {
+	c.locations = nil
+	for _, proj := range c.Projects {
+		if proj != nil {
+			proj.locations = nil
+		}
+	}
+}
+
+// validator collects problems, locating them in the file they came from.
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(file string, locations map[string]Location, prefix, p, format string, args ...any) {
+	loc := Location{File: file}
+	// Fall back to the closest located parent, e.g. the route of a missing
+	// key.
+	for key := p; ; {
+		if l, ok := locations[key]; ok {
+			loc.Line, loc.Column = l.Line, l.Column
+			break
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			if l, ok := locations[""]; ok && key != "" {
+				loc.Line, loc.Column = l.Line, l.Column
+			}
+			break
+		}
+		key = key[:i]
+	}
+	v.problems = append(v.problems, Problem{
+		Location: loc,
+		Path:     joinPath(prefix, p),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the semantics of a configuration read from path,
+// including the projects merged from included files, and reports every
+// problem it finds as a *ValidationError.
+func Validate(path string, cfg *Config) error {
+	v := &validator{}
+	v.settings(path, cfg)
+	owners := map[string]string{}
+	for _, name := range projectNames(cfg.Projects) {
+		v.project(path, name, cfg.Projects[name], cfg.Projects, owners)
+	}
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+func (v *validator) settings(file string, cfg *Config) {
+	problem := func(p, format string, args ...any) {
+		v.add(file, cfg.locations, "", p, format, args...)
+	}
+	if l := cfg.Logging; l != nil {
+		if l.Level != "" && !strings.EqualFold(l.Level, "off") {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+				problem("logging.level", "unknown level %q; use debug, info, warn, error or off", l.Level)
+			}
+		}
+		if !oneOf(l.Format, "", LogFormatText, LogFormatJSON, LogFormatCommon, LogFormatCombined) {
+			problem("logging.format", "unknown format %q; use text, json, common or combined", l.Format)
+		}
+		if !oneOf(l.Output, "", LogOutputStderr, LogOutputFile, LogOutputBoth) {
+			problem("logging.output", "unknown output %q; use stderr, file or both", l.Output)
+		}
+		if l.MaxSizeMB < 0 {
+			problem("logging.maxSizeMB", "must not be negative")
+		}
+		if l.MaxBackups != nil && *l.MaxBackups < 0 {
+			problem("logging.maxBackups", "must not be negative")
+		}
+	}
+	if t := cfg.Tracing; t != nil && t.Endpoint != "" {
+		u, err := url.Parse(t.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("tracing.endpoint", "must be an http or https URL such as http://127.0.0.1:4318/v1/traces")
+		}
+	}
+}
+
+func (v *validator) project(mainFile, name string, proj *Project, projects map[string]*Project, owners map[string]string) {
+	prefix := "projects." + name
+	file := proj.Source
+	if file == "" {
+		file = mainFile
+	}
+	problem := func(p, format string, args ...any) {
+		v.add(file, proj.locations, prefix, p, format, args...)
+	}
+
+	if len(proj.Domains) == 0 {
+		problem("domains", "at least one domain is required")
+	}
+	for i, domain := range proj.Domains {
+		p := fmt.Sprintf("domains[%d]", i)
+		key := strings.ToLower(domain)
+		switch {
+		case strings.ContainsAny(domain, ":/ "):
+			problem(p, "domain %s must be a host name without scheme, port or path", domain)
+		case !strings.HasSuffix(key, ".localhost"):
+			problem(p, "domain %s must end with .localhost", domain)
+		case key == ReservedDomain:
+			problem(p, "domain %s is reserved for the traffic inspector", domain)
+		}
+		switch owner, ok := owners[key]; {
+		case !ok:
+			owners[key] = name
+		case owner == name:
+			problem(p, "domain %s is listed twice", domain)
+		default:
+			problem(p, "domain %s is also used by project %s (%s)", domain, owner, sourceOf(projects[owner], mainFile))
+		}
+	}
+
+	checkHeaders(proj.Headers, func(sub, format string, args ...any) { problem("headers"+sub, format, args...) })
+
+	if len(proj.Routes) == 0 {
+		problem("routes", "at least one route is required")
+	}
+	paths := map[string]int{}
+	fallback := -1
+	for i, r := range proj.Routes {
+		p := fmt.Sprintf("routes[%d]", i)
+		if r == nil {
+			problem(p, "route is empty")
+			continue
+		}
+		if !strings.HasPrefix(r.Path, "/") {
+			problem(p+".path", "path must start with '/' (got %q)", r.Path)
+		} else if j, ok := paths[r.Path]; ok {
+			problem(p+".path", "path %s is already routed by routes[%d]", r.Path, j)
+		} else {
+			paths[r.Path] = i
+		}
+		if r.SpaFallback {
+			switch {
+			case r.Path != "/":
+				problem(p+".spaFallback", "spaFallback only applies to the / route")
+			case fallback >= 0:
+				problem(p+".spaFallback", "routes[%d] is already the SPA fallback", fallback)
+			default:
+				fallback = i
+			}
+		}
+		v.route(r, func(sub, format string, args ...any) { problem(p+sub, format, args...) })
+	}
+}
+
+func sourceOf(proj *Project, mainFile string) string {
+	if proj == nil || proj.Source == "" {
+		return mainFile
+	}
+	return proj.Source
+}
+
+func (v *validator) route(r *Route, problem func(p, format string, args ...any)) {
+	targets := r.Targets()
+	autoPort := r.Command != nil && r.Command.AutoPort
+	switch {
+	case r.Root != "" && len(targets) > 0:
+		problem(".root", "a route cannot have both a root and an upstream")
+	case r.Root != "" && r.Mock != nil:
+		problem(".root", "a route cannot have both a root and a mock")
+	case r.Root != "" && r.Replay != "":
+		problem(".replay", "a route cannot have both a root and a replay file")
+	case r.Replay != "" && len(targets) > 0:
+		problem(".replay", "a route cannot have both a replay file and an upstream")
+	case r.Replay != "" && r.Mock != nil:
+		problem(".replay", "a route cannot have both a replay file and a mock")
+	case r.Root == "" && r.Mock == nil && r.Replay == "" && len(targets) == 0 && !autoPort:
+		problem("", "a route needs an upstream, root, mock or replay file")
+	}
+	for i, raw := range r.Upstreams {
+		if msg := checkUpstream(raw); msg != "" {
+			problem(fmt.Sprintf(".upstreams[%d]", i), "%s", msg)
+		}
+	}
+	if r.Upstream != "" {
+		if msg := checkUpstream(r.Upstream); msg != "" {
+			problem(".upstream", "%s", msg)
+		}
+	}
+	if lb := r.LoadBalancing; lb != nil {
+		switch lb.Policy {
+		case "", PolicyRoundRobin, PolicyLeastConnections, PolicyCookie:
+		case PolicyHeader:
+			if lb.Header == "" {
+				problem(".loadBalancing.header", "the header policy requires a header name")
+			}
+		default:
+			problem(".loadBalancing.policy", "unknown policy %q; use %s, %s, %s or %s",
+				lb.Policy, PolicyRoundRobin, PolicyLeastConnections, PolicyCookie, PolicyHeader)
+		}
+	}
+	if hc := r.HealthCheck; hc != nil {
+		if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+			problem(".healthCheck.path", "path must start with '/' (got %q)", hc.Path)
+		}
+		if hc.ExpectStatus != 0 && !validStatus(hc.ExpectStatus) {
+			problem(".healthCheck.expectStatus", "%d is not an HTTP status code", hc.ExpectStatus)
+		}
+		if hc.UnhealthyThreshold < 0 || hc.HealthyThreshold < 0 || hc.Interval < 0 || hc.Timeout < 0 {
+			problem(".healthCheck", "intervals and thresholds must not be negative")
+		}
+	}
+	if rp := r.Retry; rp != nil && (rp.Timeout < 0 || rp.Interval < 0 || rp.MaxBodyBytes < 0) {
+		problem(".retry", "timeouts and sizes must not be negative")
+	}
+	if m := r.Mock; m != nil {
+		for i, resp := range m.Responses {
+			p := fmt.Sprintf(".mock.responses[%d]", i)
+			if resp == nil {
+				problem(p, "response is empty")
+				continue
+			}
+			if resp.Match.Path != "" && !strings.HasPrefix(resp.Match.Path, "/") {
+				problem(p+".match.path", "path must start with '/' (got %q)", resp.Match.Path)
+			}
+			if resp.Body != "" && resp.BodyFile != "" {
+				problem(p+".bodyFile", "body and bodyFile are mutually exclusive")
+			}
+			if resp.Status != 0 && !validStatus(resp.Status) {
+				problem(p+".status", "%d is not an HTTP status code", resp.Status)
+			}
+		}
+	}
+	if c := r.Command; c != nil {
+		if strings.TrimSpace(c.Cmd) == "" {
+			problem(".command.cmd", "command is empty")
+		}
+		if c.PortEnv != "" && !validVariableName(c.PortEnv) {
+			problem(".command.portEnv", "%q is not a valid environment variable name", c.PortEnv)
+		}
+		if c.Ready != nil && c.Ready.Path != "" && !strings.HasPrefix(c.Ready.Path, "/") {
+			problem(".command.ready.path", "path must start with '/' (got %q)", c.Ready.Path)
+		}
+	}
+	checkHeaders(r.Headers, func(sub, format string, args ...any) { problem(".headers"+sub, format, args...) })
+}
+
+func checkHeaders(h *Headers, problem func(p, format string, args ...any)) {
+	if h == nil {
+		return
+	}
+	for _, list := range []struct {
+		name  string
+		rules []*HeaderRule
+	}{{"request", h.Request}, {"response", h.Response}} {
+		for i, rule := range list.rules {
+			p := fmt.Sprintf(".%s[%d]", list.name, i)
+			if rule == nil {
+				problem(p, "rule is empty")
+				continue
+			}
+			checkHeaderRule(rule, list.name == "request", func(sub, format string, args ...any) { problem(p+sub, format, args...) })
+		}
+	}
+}
+
+func checkHeaderRule(rule *HeaderRule, request bool, problem func(p, format string, args ...any)) {
+	var action, name string
+	for _, a := range []struct{ action, name string }{
+		{"set", rule.Set}, {"add", rule.Add}, {"remove", rule.Remove}, {"rename", rule.Rename},
+	} {
+		if a.name == "" {
+			continue
+		}
+		if action != "" {
+			problem("."+a.action, "a rule cannot both %s and %s a header", action, a.action)
+			return
+		}
+		action, name = a.action, a.name
+	}
+	if action == "" {
+		problem("", "a rule needs one of set, add, remove or rename")
+		return
+	}
+	if !validHeaderName(name) {
+		problem("."+action, "%q is not a valid header name", name)
+	}
+	if request && strings.EqualFold(name, "Host") {
+		problem("."+action, "the Host header is taken from the upstream URL and cannot be changed")
+	}
+	switch action {
+	case "set", "add":
+		if _, err := template.New("value").Parse(rule.Value); err != nil {
+			problem(".value", "invalid template: %v", err)
+		}
+	case "rename":
+		switch {
+		case rule.To == "":
+			problem(".to", "rename requires the new header name in to")
+		case !validHeaderName(rule.To):
+			problem(".to", "%q is not a valid header name", rule.To)
+		}
+	}
+	if rule.Value != "" && action != "set" && action != "add" {
+		problem(".value", "value only applies to set and add")
+	}
+	if rule.To != "" && action != "rename" {
+		problem(".to", "to only applies to rename")
+	}
+}
+
+// validHeaderName reports whether name is an HTTP token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// checkUpstream mirrors the upstream forms the proxy understands.
+func checkUpstream(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Sprintf("invalid upstream %q: %v", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+		if u.Host == "" {
+			return fmt.Sprintf("upstream %q has no host", raw)
+		}
+	case "unix":
+		socket, base, _ := strings.Cut(u.Path, ":")
+		switch {
+		case u.Host != "":
+			return fmt.Sprintf("unix upstream must use an absolute socket path (unix:///path/to.sock), got host %q", u.Host)
+		case socket == "":
+			return "unix upstream requires a socket path"
+		case base != "" && !strings.HasPrefix(base, "/"):
+			return fmt.Sprintf("unix upstream base path must start with '/' (got %s)", base)
+		}
+	default:
+		return fmt.Sprintf("upstream %q must use http, https, ws, wss or unix", raw)
+	}
+	return ""
+}
+
+func validStatus(code int) bool {
+	return code >= 100 && code <= 599
+}
+
+func oneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
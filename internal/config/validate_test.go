@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateReportsEveryProblemWithLocation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	writeFile(t, path, `include: [repo]
+logging:
+  format: xml
+projects:
+  web:
+    domains: [web.localhost, shop.localhost, shop.localhost]
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:3000
+        spaFallback: true
+      - path: /
+        root: ./public
+        spaFallback: true
+      - path: api
+        upstream: ftp://127.0.0.1
+  empty:
+    domains: [devlink.localhost]
+`)
+	repoFile := filepath.Join(dir, "repo", ProjectFileName)
+	writeFile(t, repoFile, `projects:
+  repo:
+    domains: [WEB.localhost]
+    routes:
+      - path: /
+        loadBalancing:
+          policy: random
+`)
+	snap, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Validate(path, snap.Config)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	want := []string{
+		path + ":3:3: logging.format: unknown format",
+		path + ":17:15: projects.empty.domains[0]: domain devlink.localhost is reserved",
+		path + ":16:3: projects.empty.routes: at least one route is required",
+		repoFile + ":5:9: projects.repo.routes[0]: a route needs an upstream",
+		repoFile + ":7:11: projects.repo.routes[0].loadBalancing.policy: unknown policy",
+		path + ":6:15: projects.web.domains[0]: domain web.localhost is also used by project repo (" + repoFile + ")",
+		path + ":6:46: projects.web.domains[2]: domain shop.localhost is listed twice",
+		path + ":11:9: projects.web.routes[1].path: path / is already routed by routes[0]",
+		path + ":13:9: projects.web.routes[1].spaFallback: routes[0] is already the SPA fallback",
+		path + ":14:9: projects.web.routes[2].path: path must start with '/'",
+		path + ":15:9: projects.web.routes[2].upstream: upstream \"ftp://127.0.0.1\" must use",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Errorf("expected %d problems, got %d:\n%v", len(want), len(verr.Problems), err)
+	}
+	for i, w := range want {
+		if i >= len(verr.Problems) {
+			break
+		}
+		if got := verr.Problems[i].String(); !strings.HasPrefix(got, w) {
+			t.Errorf("problem %d:\n got %s\nwant %s...", i, got, w)
+		}
+	}
+}
+
+func TestEditRejectsInvalidResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	err := Edit(path, func(cfg *Config) error {
+		cfg.Projects["web"] = &Project{Domains: []string{"web.example.com"}, Routes: []*Route{{Path: "/", Root: "."}}}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), path+": projects.web.domains[0]: domain web.example.com must end with .localhost") {
+		t.Fatalf("expected a located validation error, got %v", err)
+	}
+	if rev, _ := ReadRevision(path); rev != "" {
+		t.Fatal("expected the invalid configuration not to be saved")
+	}
+}
+
+func TestValidateHeaderRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	writeFile(t, path, `projects:
+  web:
+    domains: [web.localhost]
+    headers:
+      request:
+        - set: X-Tenant
+          value: "{{.Label}}"
+        - set: Host
+          value: other
+    routes:
+      - path: /
+        upstream: http://127.0.0.1:3000
+        headers:
+          request:
+            - rename: X-Old
+          response:
+            - remove: X-Powered-*
+            - set: Bad Name
+              add: X-Other
+            - add: X-Broken
+              value: "{{.Route"
+            - remove: X-Secret
+              value: x
+            -
+`)
+	snap, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Validate(path, snap.Config)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	want := []string{
+		path + ":8:11: projects.web.headers.request[1].set: the Host header",
+		path + ":15:15: projects.web.routes[0].headers.request[0].to: rename requires",
+		path + ":19:15: projects.web.routes[0].headers.response[1].add: a rule cannot both set and add",
+		path + ":21:15: projects.web.routes[0].headers.response[2].value: invalid template",
+		path + ":23:15: projects.web.routes[0].headers.response[3].value: value only applies",
+		path + ":24:14: projects.web.routes[0].headers.response[4]: rule is empty",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Errorf("expected %d problems, got %d:\n%v", len(want), len(verr.Problems), err)
+	}
+	for i, w := range want {
+		if i >= len(verr.Problems) {
+			break
+		}
+		if got := verr.Problems[i].String(); !strings.HasPrefix(got, w) {
+			t.Errorf("problem %d:\n got %s\nwant %s...", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the configuration layout this build reads and writes.
+// Older files are upgraded by the migrations when they are parsed.
+const CurrentVersion = 1
+
+// migrations upgrade the document of an older layout one version at a time:
+// migrations[v] turns version v into version v+1. They work on the YAML
+// nodes, so writing an upgraded file back keeps its comments.
+var migrations = []func(root *yaml.Node) error{
+	// Version 0 files predate the version key and already use the version 1
+	// layout.
+	func(root *yaml.Node) error { return nil },
+}
+
+// decodeDocument parses data and upgrades it to CurrentVersion. It returns
+// the document node, nil for an empty document, and the version the file
+// declared.
+func decodeDocument(data []byte) (doc *yaml.Node, from int, err error) {
+	doc = &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal config: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return doc, CurrentVersion, nil
+	}
+	root := doc.Content[0]
+	if key, value := mappingValue(root, "version"); value != nil {
+		if err := value.Decode(&from); err != nil || from < 0 {
+			return nil, 0, fmt.Errorf("line %d: version must be a non-negative integer", key.Line)
+		}
+	}
+	if from > CurrentVersion {
+		return nil, 0, fmt.Errorf("config version %d is newer than this devlink supports (%d); upgrade devlink", from, CurrentVersion)
+	}
+	for v := from; v < CurrentVersion; v++ {
+		if err := migrations[v](root); err != nil {
+			return nil, 0, fmt.Errorf("migrate config from version %d: %w", v, err)
+		}
+	}
+	setMappingValue(root, "version", fmt.Sprint(CurrentVersion))
+	return doc, from, nil
+}
+
+// Migrate upgrades the file at path to CurrentVersion in place, keeping its
+// comments, and returns the version it had. Current files are not touched.
+func Migrate(path string) (from int, err error) {
+	unlock, err := Lock(path)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read config: %w", err)
+	}
+	doc, from, err := decodeDocument(data)
+	if err != nil {
+		return 0, err
+	}
+	if from == CurrentVersion || len(doc.Content) == 0 {
+		return from, nil
+	}
+	if err := checkFields(doc.Content[0], reflect.TypeOf(Config{}), ""); err != nil {
+		return from, err
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return from, fmt.Errorf("marshal config: %w", err)
+	}
+	return from, writeAtomic(path, out)
+}
+
+func mappingValue(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// setMappingValue sets a scalar key, adding it first in the mapping when it
+// is missing.
+func setMappingValue(mapping *yaml.Node, key, value string) {
+	if _, node := mappingValue(mapping, key); node != nil {
+		node.Kind, node.Tag, node.Value, node.Content = yaml.ScalarNode, "", value, nil
+		return
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+	if len(mapping.Content) > 0 {
+		// Keep a comment heading the file above the new key.
+		keyNode.HeadComment, mapping.Content[0].HeadComment = mapping.Content[0].HeadComment, ""
+	}
+	mapping.Content = append([]*yaml.Node{keyNode, {Kind: yaml.ScalarNode, Value: value}}, mapping.Content...)
+}
+
+// FieldError reports a key the configuration schema does not know.
+type FieldError struct {
+	Line   int
+	Column int
+	// Path locates the mapping holding the key, such as
+	// projects.web.routes[0].
+	Path  string
+	Field string
+	// Suggestion is a known key the field may be a misspelling of.
+	Suggestion string
+}
+
+func (e *FieldError) Error() string {
+	msg := fmt.Sprintf("line %d: unknown field %q", e.Line, e.Field)
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", e.Suggestion)
+	}
+	return msg
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkFields reports every mapping key below node that has no field in t.
+// Type mismatches are left to the decoder.
+func checkFields(node *yaml.Node, t reflect.Type, path string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+	var errs []error
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, &FieldError{
+					Line:       key.Line,
+					Column:     key.Column,
+					Path:       path,
+					Field:      key.Value,
+					Suggestion: suggestField(key.Value, fields),
+				})
+				continue
+			}
+			errs = append(errs, checkFields(value, field.Type, joinPath(path, key.Value)))
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = append(errs, checkFields(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value)))
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			errs = append(errs, checkFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// yamlFields maps the YAML keys of a struct type to its fields.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// suggestField returns the known key closest to name when it is a likely
+// misspelling.
+func suggestField(name string, fields map[string]reflect.StructField) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	best, bestDist := "", 3
+	for _, key := range keys {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(key)); d < bestDist {
+			best, bestDist = key, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
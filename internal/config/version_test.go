@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrationsCoverEveryVersion(t *testing.T) {
+	if len(migrations) != CurrentVersion {
+		t.Fatalf("expected %d migrations, got %d", CurrentVersion, len(migrations))
+	}
+}
+
+func TestMigrationsUpgradeOlderFiles(t *testing.T) {
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	// A stub migration renaming the old "sites" key to "projects".
+	migrations = []func(root *yaml.Node) error{
+		func(root *yaml.Node) error {
+			if key, _ := mappingValue(root, "sites"); key != nil {
+				key.Value = "projects"
+			}
+			return nil
+		},
+	}
+
+	cfg, err := Parse([]byte("sites:\n  web:\n    domains: [web.localhost]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Projects["web"]; !ok {
+		t.Fatalf("expected the migrated project, got %+v", cfg.Projects)
+	}
+
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	writeFile(t, path, "version: 0\nsites: # renamed\n  web:\n    domains: [web.localhost]\n")
+	if from, err := Migrate(path); err != nil || from != 0 {
+		t.Fatalf("expected version 0 to be migrated, got %d, %v", from, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.HasPrefix(got, "version: 1\nprojects: # renamed\n") {
+		t.Fatalf("unexpected migrated file:\n%s", got)
+	}
+}
+
+func TestMigrationsReportErrors(t *testing.T) {
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = []func(root *yaml.Node) error{
+		func(root *yaml.Node) error { return errors.New("unsupported layout") },
+	}
+	_, err := Parse([]byte("projects: {}\n"))
+	if err == nil || !strings.Contains(err.Error(), "migrate config from version 0: unsupported layout") {
+		t.Fatalf("expected a migration error, got %v", err)
+	}
+}
+
+func TestParseRejectsUnknownFieldsWithLines(t *testing.T) {
+	data := "projects:\n  web:\n    domains: [web.localhost]\n    routes:\n      - path: /\n        upstreem: http://127.0.0.1:3000\n    colour: blue\n"
+	_, err := Parse([]byte(data))
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("expected a field error, got %v", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		`line 6: unknown field "upstreem" in projects.web.routes[0] (did you mean "upstream"?)`,
+		`line 7: unknown field "colour" in projects.web`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in:\n%s", want, msg)
+		}
+	}
+}
+
+func TestParseRejectsNewerVersions(t *testing.T) {
+	if _, err := Parse([]byte("version: 99\n")); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
+
+func TestMigrateWritesVersionAndKeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devlink.yaml")
+	writeFile(t, path, "# shared routes\nprojects:\n  web:\n    domains: [web.localhost] # main site\n")
+	from, err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 0 {
+		t.Fatalf("expected version 0, got %d", from)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "# shared routes\nversion: 1\n") || !strings.Contains(got, "# main site") {
+		t.Fatalf("unexpected migrated file:\n%s", got)
+	}
+	if from, err := Migrate(path); err != nil || from != CurrentVersion {
+		t.Fatalf("expected a current file to be left alone, got %d, %v", from, err)
+	}
+}
+
+func TestSchemaDescribesConfig(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Properties           map[string]map[string]any `json:"properties"`
+			AdditionalProperties bool                      `json:"additionalProperties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"version", "include", "logging", "tracing", "projects"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("expected top-level property %s", key)
+		}
+	}
+	route := schema.Defs["Route"]
+	if route.AdditionalProperties || route.Properties["upstream"]["type"] != "string" {
+		t.Errorf("unexpected route schema: %+v", route)
+	}
+	if _, ok := route.Properties["retry"]["$ref"]; !ok {
+		t.Errorf("expected the retry policy to be referenced, got %v", route.Properties["retry"])
+	}
+}
+
+func TestSchemaDurationPatternMatchesDurations(t *testing.T) {
+	pattern := regexp.MustCompile(schemaFor(durationType, nil)["pattern"].(string))
+	for _, value := range []string{"0", "0s", "500ms", "1m30s", "1.5h"} {
+		if !pattern.MatchString(value) {
+			t.Errorf("expected %q to match the duration pattern", value)
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			t.Errorf("expected %q to be a valid duration: %v", value, err)
+		}
+	}
+	for _, value := range []string{"", "5", "00", "1d", "ms"} {
+		if pattern.MatchString(value) {
+			t.Errorf("expected %q not to match the duration pattern", value)
+		}
+	}
+}
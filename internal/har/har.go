@@ -0,0 +1,213 @@
+// Package har reads and writes HTTP Archive (HAR 1.2) files and replays
+// them as an HTTP upstream.
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// HAR is the root of an HTTP Archive document.
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log holds the recorded entries.
+type Log struct {
+	Version string   `json:"version"`
+	Creator Creator  `json:"creator"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Creator names the application that produced the archive.
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a single request/response exchange.
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	Comment         string   `json:"comment,omitempty"`
+	// Project and Route record where Devlink routed the request.
+	Project string `json:"_project,omitempty"`
+	Route   string `json:"_route,omitempty"`
+}
+
+// Request describes the upstream request.
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	Cookies     []NameValue `json:"cookies"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	PostData    *PostData   `json:"postData,omitempty"`
+}
+
+// Response describes the upstream response.
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []NameValue `json:"headers"`
+	Cookies     []NameValue `json:"cookies"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+// NameValue is a header, query parameter or cookie.
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is a captured request body.
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+// Content is a captured response body. Binary bodies are base64 encoded.
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Timings are phase durations in milliseconds; -1 marks a phase that did
+// not apply.
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// New returns an empty archive created by Devlink.
+func New() *HAR {
+	return &HAR{Log: Log{
+		Version: "1.2",
+		Creator: Creator{Name: "devlink", Version: "1"},
+		Entries: []*Entry{},
+	}}
+}
+
+// Load reads an archive from disk.
+func Load(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read har: %w", err)
+	}
+	h := &HAR{}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("parse har: %w", err)
+	}
+	return h, nil
+}
+
+// Save writes the archive to path, replacing it atomically.
+func Save(path string, h *HAR) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create har dir: %w", err)
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal har: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write har: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write har: %w", err)
+	}
+	return nil
+}
+
+// entriesTrailer closes the entries array and the document as MarshalIndent
+// would lay them out.
+const entriesTrailer = "\n    ]\n  }\n}\n"
+
+// Writer appends entries to an archive on disk. The file is a complete
+// archive after every Append, and each entry is written once, so a long
+// recording neither holds its entries in memory nor rewrites the file.
+type Writer struct {
+	f *os.File
+	// end is the offset of the trailer, where the next entry goes.
+	end     int64
+	entries int
+}
+
+// Create starts an empty archive at path, replacing any file there.
+func Create(path string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create har dir: %w", err)
+	}
+	data, err := json.MarshalIndent(New(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal har: %w", err)
+	}
+	// Cut the empty entries array open after its bracket.
+	head := data[:bytes.LastIndex(data, []byte("[]"))+1]
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("write har: %w", err)
+	}
+	w := &Writer{f: f, end: int64(len(head))}
+	if _, err := f.Write(append(head, entriesTrailer...)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write har: %w", err)
+	}
+	return w, nil
+}
+
+// Append writes entries at the end of the archive.
+func (w *Writer) Append(entries ...*Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for i, e := range entries {
+		data, err := json.MarshalIndent(e, "      ", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal har: %w", err)
+		}
+		if w.entries+i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("\n      ")
+		buf.Write(data)
+	}
+	n := int64(buf.Len())
+	buf.WriteString(entriesTrailer)
+	if _, err := w.f.WriteAt(buf.Bytes(), w.end); err != nil {
+		return fmt.Errorf("write har: %w", err)
+	}
+	w.end += n
+	w.entries += len(entries)
+	return nil
+}
+
+// Close closes the archive file.
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,49 @@
+package har
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterAppendsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.har")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	defer w.Close()
+	if h, err := Load(path); err != nil || len(h.Log.Entries) != 0 || h.Log.Creator.Name != "devlink" {
+		t.Fatalf("expected an empty archive, got %+v, %v", h, err)
+	}
+
+	if err := w.Append(entry("GET", "http://127.0.0.1/a", 200, "a")); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(entry("GET", "http://127.0.0.1/b", 200, "b"), entry("GET", "http://127.0.0.1/c", 0, "")); err != nil {
+		t.Fatalf("Append returned error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix := strings.TrimSuffix(string(first), entriesTrailer); !strings.HasPrefix(string(data), prefix) {
+		t.Fatal("expected written entries to be left in place")
+	}
+	h, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	var urls []string
+	for _, e := range h.Log.Entries {
+		urls = append(urls, e.Request.URL)
+	}
+	if got := strings.Join(urls, " "); got != "http://127.0.0.1/a http://127.0.0.1/b http://127.0.0.1/c" {
+		t.Fatalf("unexpected entries %s", got)
+	}
+}
@@ -0,0 +1,109 @@
+package har
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// skipReplayHeaders are recomputed by the server when replaying.
+var skipReplayHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Date":              true,
+}
+
+// Replayer serves recorded responses. Requests are matched by method, path
+// and query, falling back to method and path alone. When several entries
+// match, they are served in recording order and the last one repeats, so a
+// replay session is deterministic.
+type Replayer struct {
+	mu      sync.Mutex
+	entries map[string][]*Entry
+	served  map[string]int
+}
+
+// NewReplayer indexes the entries of h.
+func NewReplayer(h *HAR) *Replayer {
+	r := &Replayer{entries: map[string][]*Entry{}, served: map[string]int{}}
+	for _, e := range h.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			continue
+		}
+		exact := replayKey(e.Request.Method, u.Path, u.RawQuery)
+		loose := replayKey(e.Request.Method, u.Path, "*")
+		r.entries[exact] = append(r.entries[exact], e)
+		r.entries[loose] = append(r.entries[loose], e)
+	}
+	return r
+}
+
+func replayKey(method, path, query string) string {
+	return strings.ToUpper(method) + " " + path + "?" + query
+}
+
+func (r *Replayer) next(req *http.Request) *Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range []string{
+		replayKey(req.Method, req.URL.Path, req.URL.RawQuery),
+		replayKey(req.Method, req.URL.Path, "*"),
+	} {
+		entries := r.entries[key]
+		if len(entries) == 0 {
+			continue
+		}
+		idx := r.served[key]
+		if idx >= len(entries) {
+			idx = len(entries) - 1
+		}
+		r.served[key] = idx + 1
+		return entries[idx]
+	}
+	return nil
+}
+
+func (r *Replayer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	entry := r.next(req)
+	if entry == nil {
+		http.Error(w, fmt.Sprintf("no recording for %s %s", req.Method, req.URL.RequestURI()), http.StatusNotFound)
+		return
+	}
+	if entry.Response.Status < 100 {
+		// Failed exchanges are recorded with status 0, as browsers do.
+		w.Header().Set("X-Devlink-Replay", "true")
+		msg := "recorded exchange has no response"
+		if entry.Comment != "" {
+			msg += ": " + entry.Comment
+		}
+		http.Error(w, msg, http.StatusBadGateway)
+		return
+	}
+	body := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+		if err != nil {
+			http.Error(w, "invalid recorded body: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = decoded
+	}
+	for _, h := range entry.Response.Headers {
+		if skipReplayHeaders[http.CanonicalHeaderKey(h.Name)] {
+			continue
+		}
+		w.Header().Add(h.Name, h.Value)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Devlink-Replay", "true")
+	w.WriteHeader(entry.Response.Status)
+	if req.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
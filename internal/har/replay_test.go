@@ -0,0 +1,68 @@
+package har
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func entry(method, url string, status int, body string) *Entry {
+	return &Entry{
+		Request:  Request{Method: method, URL: url},
+		Response: Response{Status: status, Content: Content{Text: body}, Headers: []NameValue{{Name: "Content-Length", Value: "999"}}},
+	}
+}
+
+func TestReplayerIsDeterministic(t *testing.T) {
+	h := New()
+	h.Log.Entries = []*Entry{
+		entry("GET", "http://127.0.0.1:8080/items?page=1", 200, "first"),
+		entry("GET", "http://127.0.0.1:8080/items?page=1", 200, "second"),
+		entry("GET", "http://127.0.0.1:8080/items?page=2", 200, "page two"),
+		{
+			Request:  Request{Method: "GET", URL: "http://127.0.0.1:8080/logo.png"},
+			Response: Response{Status: 200, Content: Content{Text: base64.StdEncoding.EncodeToString([]byte{0x89, 0x50}), Encoding: "base64"}},
+		},
+	}
+	replayer := NewReplayer(h)
+
+	get := func(target string) (int, string) {
+		rec := httptest.NewRecorder()
+		replayer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+	for _, want := range []string{"first", "second", "second"} {
+		if _, body := get("/items?page=1"); body != want {
+			t.Fatalf("expected %q, got %q", want, body)
+		}
+	}
+	if _, body := get("/items?page=2"); body != "page two" {
+		t.Fatalf("expected exact query match, got %q", body)
+	}
+	if _, body := get("/items?page=9"); body != "first" {
+		t.Fatalf("expected path-only fallback, got %q", body)
+	}
+	if _, body := get("/logo.png"); body != "\x89\x50" {
+		t.Fatalf("expected decoded binary body, got %q", body)
+	}
+	if code, _ := get("/missing"); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+}
+
+func TestReplayerAnswersFailedExchangesWithBadGateway(t *testing.T) {
+	h := New()
+	failed := entry("GET", "http://127.0.0.1:8080/down", 0, "")
+	failed.Comment = "upstream error: connection refused"
+	h.Log.Entries = []*Entry{failed}
+
+	rec := httptest.NewRecorder()
+	NewReplayer(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/down", nil))
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "connection refused") {
+		t.Fatalf("expected 502 with the recorded error, got %d %q", rec.Code, rec.Body.String())
+	}
+}
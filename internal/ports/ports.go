@@ -0,0 +1,227 @@
+package ports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"local-ssl/internal/config"
+)
+
+const (
+	stateFileName = "ports.json"
+	// leaseFileName records which devlink up process runs each project, so
+	// that another one does not move its ports.
+	leaseFileName = "leases.json"
+)
+
+// Path returns the file holding the port assignments in a state directory.
+// The server reloads when it changes.
+func Path(dir string) string {
+	return filepath.Join(dir, stateFileName)
+}
+
+// Store persists loopback ports allocated to supervised routes so that their
+// upstreams stay stable across restarts.
+type Store struct {
+	path   string
+	leases string
+	mu     sync.Mutex
+}
+
+// Open returns the store kept in the given state directory.
+func Open(dir string) *Store {
+	return &Store{path: Path(dir), leases: filepath.Join(dir, leaseFileName)}
+}
+
+func (s *Store) assign(project, route string, verify bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assignments, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	if port, ok := assignments[project][route]; ok && (!verify || bindable(port)) {
+		return port, nil
+	}
+	port, err := freePort()
+	if err != nil {
+		return 0, err
+	}
+	if assignments[project] == nil {
+		assignments[project] = map[string]int{}
+	}
+	assignments[project][route] = port
+	if err := s.save(assignments); err != nil {
+		return 0, err
+	}
+	return port, nil
+}
+
+// Lookup returns the port assigned to a route without allocating one, for
+// callers that must not change the state such as devlink doctor.
+func (s *Store) Lookup(project, route string) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assignments, err := s.load()
+	if err != nil {
+		return 0, false, err
+	}
+	port, ok := assignments[project][route]
+	return port, ok, nil
+}
+
+// lease records that this process runs project. It fails when another live
+// process does, since reallocating would move the ports it listens on.
+func (s *Store) lease(project string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases := map[string]int{}
+	if err := readJSON(s.leases, &leases); err != nil {
+		return fmt.Errorf("read port leases: %w", err)
+	}
+	pid := os.Getpid()
+	if owner, ok := leases[project]; ok && owner != pid && processAlive(owner) {
+		return fmt.Errorf("project %s is already running under devlink up (pid %d)", project, owner)
+	}
+	leases[project] = pid
+	if err := writeJSON(s.leases, leases); err != nil {
+		return fmt.Errorf("write port leases: %w", err)
+	}
+	return nil
+}
+
+// Release gives up the leases this process holds on projects.
+func (s *Store) Release(projects ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases := map[string]int{}
+	if err := readJSON(s.leases, &leases); err != nil {
+		return fmt.Errorf("read port leases: %w", err)
+	}
+	for _, project := range projects {
+		if leases[project] == os.Getpid() {
+			delete(leases, project)
+		}
+	}
+	if err := writeJSON(s.leases, leases); err != nil {
+		return fmt.Errorf("write port leases: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) load() (map[string]map[string]int, error) {
+	assignments := map[string]map[string]int{}
+	if err := readJSON(s.path, &assignments); err != nil {
+		return nil, fmt.Errorf("read port assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+func (s *Store) save(assignments map[string]map[string]int) error {
+	if err := writeJSON(s.path, assignments); err != nil {
+		return fmt.Errorf("write port assignments: %w", err)
+	}
+	return nil
+}
+
+// readJSON decodes the file at path into v, leaving v alone when the file
+// does not exist.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON replaces the file at path through a temporary file.
+func writeJSON(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Apply returns a copy of cfg with the upstream of every auto-port route
+// pointing at its assigned port. The projects named in reserve are about to
+// be started by this process: they are leased to it, and their persisted
+// ports are replaced when something else holds them. Ports of other projects
+// are never reallocated, since they may be in use by a running devlink up.
+func Apply(cfg *config.Config, store *Store, reserve ...string) (*config.Config, error) {
+	out := cfg.Clone()
+	reserved := map[string]bool{}
+	for _, name := range reserve {
+		if _, ok := out.Projects[name]; !ok {
+			continue
+		}
+		if err := store.lease(name); err != nil {
+			return nil, err
+		}
+		reserved[name] = true
+	}
+	for name, proj := range out.Projects {
+		for _, route := range proj.Routes {
+			if route.Command == nil || !route.Command.AutoPort {
+				continue
+			}
+			port, err := store.assign(name, route.Path, reserved[name])
+			if err != nil {
+				return nil, fmt.Errorf("project %s route %s: %w", name, route.Path, err)
+			}
+			route.Upstream = Upstream(route.Upstream, port)
+		}
+	}
+	return out, nil
+}
+
+// Upstream rewrites the port of upstream, defaulting to plain HTTP on the
+// IPv4 loopback address when upstream is empty or invalid.
+func Upstream(upstream string, port int) string {
+	u, err := url.Parse(upstream)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		u = &url.URL{Scheme: "http"}
+	}
+	host := u.Hostname()
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	u.Host = net.JoinHostPort(host, strconv.Itoa(port))
+	return u.String()
+}
+
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("allocate port: %w", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func bindable(port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
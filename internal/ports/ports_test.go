@@ -0,0 +1,173 @@
+package ports
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+func autoPortConfig() *config.Config {
+	cfg := config.New()
+	cfg.Projects["web"] = &config.Project{
+		Domains: []string{"web.localhost"},
+		Routes: []*config.Route{
+			{Path: "/", Command: &config.Command{Cmd: "npm run dev", AutoPort: true}},
+			{Path: "/api", Upstream: "http://127.0.0.1:8080"},
+		},
+	}
+	return cfg
+}
+
+func TestApplyPersistsAssignments(t *testing.T) {
+	store := Open(t.TempDir())
+	first, err := Apply(autoPortConfig(), store, "web")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	upstream := first.Projects["web"].Routes[0].Upstream
+	if upstream == "" {
+		t.Fatal("auto-port route has no upstream")
+	}
+	if got := first.Projects["web"].Routes[1].Upstream; got != "http://127.0.0.1:8080" {
+		t.Fatalf("static upstream was rewritten to %s", got)
+	}
+
+	second, err := Apply(autoPortConfig(), store)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if got := second.Projects["web"].Routes[0].Upstream; got != upstream {
+		t.Fatalf("expected stable upstream %s, got %s", upstream, got)
+	}
+}
+
+func TestApplyReplacesTakenPortWhenReserving(t *testing.T) {
+	store := Open(t.TempDir())
+	first, err := Apply(autoPortConfig(), store, "web")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	upstream := first.Projects["web"].Routes[0].Upstream
+	_, port, _ := net.SplitHostPort(upstream[len("http://"):])
+	ln, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	second, err := Apply(autoPortConfig(), store, "web")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if got := second.Projects["web"].Routes[0].Upstream; got == upstream {
+		t.Fatalf("expected a new port while %s is taken", port)
+	}
+}
+
+func TestUpstreamKeepsSchemeAndHost(t *testing.T) {
+	if got := Upstream("https://localhost:5173/base", 4000); got != "https://localhost:4000/base" {
+		t.Fatalf("unexpected upstream %s", got)
+	}
+	if got := Upstream("", 4000); got != "http://127.0.0.1:4000" {
+		t.Fatalf("unexpected upstream %s", got)
+	}
+}
+
+func portOf(t *testing.T, upstream string) string {
+	t.Helper()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(upstream, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestApplyKeepsPortsOfProjectsNotReserved(t *testing.T) {
+	cfg := autoPortConfig()
+	cfg.Projects["api"] = &config.Project{
+		Domains: []string{"api.localhost"},
+		Routes:  []*config.Route{{Path: "/", Command: &config.Command{Cmd: "go run .", AutoPort: true}}},
+	}
+	store := Open(t.TempDir())
+	first, err := Apply(cfg, store, "web", "api")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	// The api project is running, so its port is taken.
+	ln, err := net.Listen("tcp", "127.0.0.1:"+portOf(t, first.Projects["api"].Routes[0].Upstream))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	second, err := Apply(cfg, store, "web")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if got, want := second.Projects["api"].Routes[0].Upstream, first.Projects["api"].Routes[0].Upstream; got != want {
+		t.Fatalf("expected the running project to keep %s, got %s", want, got)
+	}
+}
+
+func TestApplyRefusesProjectLeasedToLiveProcess(t *testing.T) {
+	dir := t.TempDir()
+	store := Open(dir)
+	// The parent of the test binary stands in for another devlink up.
+	lease := fmt.Sprintf(`{"web": %d}`, os.Getppid())
+	if err := os.WriteFile(filepath.Join(dir, leaseFileName), []byte(lease), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Apply(autoPortConfig(), store, "web"); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected the live lease to be refused, got %v", err)
+	}
+	if _, err := Apply(autoPortConfig(), store); err != nil {
+		t.Fatalf("expected resolving without reserving to work, got %v", err)
+	}
+
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lease = fmt.Sprintf(`{"web": %d}`, exited.Process.Pid)
+	if err := os.WriteFile(filepath.Join(dir, leaseFileName), []byte(lease), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Apply(autoPortConfig(), store, "web"); err != nil {
+		t.Fatalf("expected the lease of an exited process to be taken over, got %v", err)
+	}
+	if err := store.Release("web"); err != nil {
+		t.Fatalf("Release returned error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, leaseFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "web") {
+		t.Fatalf("expected the lease to be released, got %s", data)
+	}
+}
+
+func TestLookupDoesNotAllocate(t *testing.T) {
+	dir := t.TempDir()
+	store := Open(dir)
+	if _, ok, err := store.Lookup("web", "/"); err != nil || ok {
+		t.Fatalf("expected no assignment, got %v, %v", ok, err)
+	}
+	if _, err := os.Stat(Path(dir)); !os.IsNotExist(err) {
+		t.Fatalf("expected Lookup not to write %s, got %v", Path(dir), err)
+	}
+	applied, err := Apply(autoPortConfig(), store, "web")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	port, ok, err := store.Lookup("web", "/")
+	if err != nil || !ok || applied.Projects["web"].Routes[0].Upstream != Upstream("", port) {
+		t.Fatalf("expected the applied port, got %d %v %v", port, ok, err)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+const (
+	defaultLogMaxSizeMB  = 10
+	defaultLogMaxBackups = 3
+)
+
+// accessLogger writes one structured record per request handled by the
+// gateway.
+type accessLogger struct {
+	cfg    config.Logging
+	logger *slog.Logger
+	file   *rotatingFile
+}
+
+// newAccessLogger builds the access log described by cfg. It returns nil
+// when access logging is not configured or turned off. prev is reused when
+// the configuration did not change, so reloads keep the open file.
+func newAccessLogger(cfg *config.Logging, baseDir, stateDir string, prev *accessLogger) (*accessLogger, error) {
+	if cfg == nil || strings.EqualFold(cfg.Level, "off") {
+		return nil, nil
+	}
+	if prev != nil && reflect.DeepEqual(prev.cfg, *cfg) {
+		return prev, nil
+	}
+
+	level := slog.LevelInfo
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("logging: invalid level %q", cfg.Level)
+		}
+	}
+
+	l := &accessLogger{cfg: *cfg}
+	var w io.Writer
+	switch cfg.Output {
+	case "", config.LogOutputStderr:
+		w = os.Stderr
+	case config.LogOutputFile, config.LogOutputBoth:
+		name := cfg.File
+		if name == "" {
+			name = filepath.Join(stateDir, "logs", "access.log")
+		} else if !filepath.IsAbs(name) {
+			name = filepath.Join(baseDir, name)
+		}
+		maxSize, maxBackups := cfg.MaxSizeMB, defaultLogMaxBackups
+		if maxSize == 0 {
+			maxSize = defaultLogMaxSizeMB
+		}
+		if cfg.MaxBackups != nil {
+			maxBackups = *cfg.MaxBackups
+		}
+		file, err := openRotatingFile(name, int64(maxSize)<<20, maxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("logging: %w", err)
+		}
+		l.file = file
+		w = file
+		if cfg.Output == config.LogOutputBoth {
+			w = io.MultiWriter(os.Stderr, file)
+		}
+	default:
+		return nil, fmt.Errorf("logging: invalid output %q", cfg.Output)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", config.LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case config.LogFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case config.LogFormatCommon, config.LogFormatCombined:
+		handler = &clfHandler{w: w, level: level, combined: cfg.Format == config.LogFormatCombined}
+	default:
+		l.Close()
+		return nil, fmt.Errorf("logging: invalid format %q", cfg.Format)
+	}
+	l.logger = slog.New(handler)
+	return l, nil
+}
+
+// Close releases the log file, if any.
+func (l *accessLogger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// log records a finished request. Client errors are logged at warn level
+// and server errors at error level.
+func (l *accessLogger) log(info *requestInfo, r *http.Request, sw *statusWriter) {
+	status := sw.Status()
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	}
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.LogAttrs(ctx, level, "request",
+		slog.String("host", info.Host),
+		slog.String("remote", r.RemoteAddr),
+		slog.String("method", info.Method),
+		slog.String("uri", info.RequestURI),
+		slog.String("proto", r.Proto),
+		slog.String("project", info.Project),
+		slog.String("route", info.Route),
+		slog.String("path", info.OriginalPath),
+		slog.String("rewritten_path", info.RewrittenPath),
+		slog.String("upstream", info.Upstream),
+		slog.Int("status", status),
+		slog.Int64("bytes", sw.bytes),
+		slog.Float64("duration_ms", millis(time.Since(info.Start))),
+		slog.Bool("fallback", info.Fallback),
+		slog.String("referer", r.Referer()),
+		slog.String("user_agent", r.UserAgent()),
+	)
+}
+
+// clfHandler renders access records in the Common or Combined Log Format.
+type clfHandler struct {
+	w        io.Writer
+	level    slog.Level
+	combined bool
+}
+
+func (h *clfHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *clfHandler) Handle(_ context.Context, rec slog.Record) error {
+	attrs := map[string]slog.Value{}
+	rec.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	str := func(key string) string {
+		if v, ok := attrs[key]; ok && v.String() != "" {
+			return v.String()
+		}
+		return "-"
+	}
+	remote := str("remote")
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	size := str("bytes")
+	if size == "0" {
+		size = "-"
+	}
+	line := fmt.Sprintf("%s - - [%s] \"%s %s %s\" %s %s",
+		remote, rec.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		str("method"), str("uri"), str("proto"), str("status"), size)
+	if h.combined {
+		line += fmt.Sprintf(" %q %q", str("referer"), str("user_agent"))
+	}
+	_, err := io.WriteString(h.w, line+"\n")
+	return err
+}
+
+func (h *clfHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *clfHandler) WithGroup(string) slog.Handler { return h }
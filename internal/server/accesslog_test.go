@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+func logTestRequest(t *testing.T, l *accessLogger, status int) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/items?x=1", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	info := &requestInfo{
+		Start:         time.Now(),
+		Host:          "demo.localhost",
+		Method:        r.Method,
+		RequestURI:    r.URL.RequestURI(),
+		OriginalPath:  r.URL.Path,
+		Project:       "demo",
+		Route:         "/api",
+		RewrittenPath: "/items",
+		Upstream:      "http://127.0.0.1:8080",
+	}
+	sw := newStatusWriter(httptest.NewRecorder(), 0)
+	sw.WriteHeader(status)
+	sw.Write([]byte("hello"))
+	l.log(info, r, sw)
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		format string
+		check  func(t *testing.T, line string)
+	}{
+		{config.LogFormatJSON, func(t *testing.T, line string) {
+			var rec map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("invalid JSON %q: %v", line, err)
+			}
+			if rec["project"] != "demo" || rec["rewritten_path"] != "/items" || rec["status"] != float64(201) || rec["bytes"] != float64(5) {
+				t.Fatalf("unexpected record: %v", rec)
+			}
+		}},
+		{config.LogFormatCommon, func(t *testing.T, line string) {
+			if !strings.HasPrefix(line, "192.0.2.1 - - [") || !strings.HasSuffix(line, `"GET /api/items?x=1 HTTP/1.1" 201 5`) {
+				t.Fatalf("unexpected common log line: %q", line)
+			}
+		}},
+		{config.LogFormatCombined, func(t *testing.T, line string) {
+			if !strings.HasSuffix(line, `201 5 "-" "test-agent"`) {
+				t.Fatalf("unexpected combined log line: %q", line)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			file := filepath.Join(dir, tt.format+".log")
+			l, err := newAccessLogger(&config.Logging{Format: tt.format, Output: config.LogOutputFile, File: file}, dir, dir, nil)
+			if err != nil {
+				t.Fatalf("newAccessLogger returned error: %v", err)
+			}
+			defer l.Close()
+			logTestRequest(t, l, http.StatusCreated)
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, strings.TrimSpace(string(data)))
+		})
+	}
+}
+
+func TestAccessLogLevel(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "access.log")
+	l, err := newAccessLogger(&config.Logging{Level: "warn", Output: config.LogOutputFile, File: file}, dir, dir, nil)
+	if err != nil {
+		t.Fatalf("newAccessLogger returned error: %v", err)
+	}
+	defer l.Close()
+	logTestRequest(t, l, http.StatusOK)
+	logTestRequest(t, l, http.StatusBadGateway)
+	data, _ := os.ReadFile(file)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "status=502") {
+		t.Fatalf("expected only the failed request, got %q", data)
+	}
+
+	if l, err := newAccessLogger(&config.Logging{Level: "off"}, dir, dir, nil); l != nil || err != nil {
+		t.Fatalf("expected no logger when off, got %v, %v", l, err)
+	}
+	if _, err := newAccessLogger(&config.Logging{Format: "xml"}, dir, dir, nil); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Fatalf("%s: expected %q, got %q", name, want, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most two backups, stat error %v", err)
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := openRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second\n" {
+		t.Fatalf("expected only the latest line, got %q", data)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup, stat error %v", err)
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	// A non-empty directory in place of the backup makes the rename fail.
+	blocker := filepath.Join(path+".1", "blocker")
+	if err := os.MkdirAll(blocker, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first\nsecond\n" {
+		t.Fatalf("expected the current file to be kept, got %q", data)
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{path: "third\n", path + ".1": "first\nsecond\n"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Fatalf("%s: expected %q, got %q", name, want, data)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"local-ssl/internal/config"
+)
+
+const defaultStickyCookie = "devlink_upstream"
+
+// upstreamTarget is a single backend instance behind a route.
+type upstreamTarget struct {
+	raw string
+	url *url.URL
+	// socket is the Unix domain socket path for unix:// upstreams.
+	socket    string
+	transport http.RoundTripper
+	proxy     *httputil.ReverseProxy
+	id        string
+	active    int64
+	healthy   atomic.Bool
+}
+
+func newUpstreamTarget(raw string, u *url.URL, socket string) *upstreamTarget {
+	h := fnv.New32a()
+	h.Write([]byte(raw))
+	t := &upstreamTarget{
+		raw:       raw,
+		url:       u,
+		socket:    socket,
+		transport: newUpstreamTransport(socket),
+		id:        fmt.Sprintf("%08x", h.Sum32()),
+	}
+	t.healthy.Store(true)
+	return t
+}
+
+// balancer picks an upstream target for each request.
+type balancer struct {
+	policy  string
+	cookie  string
+	header  string
+	path    string
+	targets []*upstreamTarget
+	next    uint64
+}
+
+func newBalancer(lb *config.LoadBalancing, path string, targets []*upstreamTarget) (*balancer, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no upstreams")
+	}
+	b := &balancer{policy: config.PolicyRoundRobin, path: path, targets: targets}
+	if lb != nil {
+		if lb.Policy != "" {
+			b.policy = strings.ToLower(lb.Policy)
+		}
+		b.cookie = lb.Cookie
+		b.header = lb.Header
+	}
+	switch b.policy {
+	case config.PolicyRoundRobin, config.PolicyLeastConnections:
+	case config.PolicyCookie:
+		if b.cookie == "" {
+			b.cookie = defaultStickyCookie
+		}
+	case config.PolicyHeader:
+		if b.header == "" {
+			return nil, errors.New("header load balancing requires a header name")
+		}
+	default:
+		return nil, fmt.Errorf("unknown load balancing policy %q", b.policy)
+	}
+	return b, nil
+}
+
+// pick returns the target for r or nil when every target is unhealthy. Sticky
+// policies may set a cookie on w so later requests reach the same target.
+func (b *balancer) pick(w http.ResponseWriter, r *http.Request) *upstreamTarget {
+	healthy := b.healthyTargets()
+	if len(healthy) == 0 {
+		return nil
+	}
+	if len(healthy) == 1 && b.policy != config.PolicyCookie {
+		return healthy[0]
+	}
+	switch b.policy {
+	case config.PolicyLeastConnections:
+		return b.leastConnections(healthy)
+	case config.PolicyCookie:
+		if c, err := r.Cookie(b.cookie); err == nil {
+			for _, t := range healthy {
+				if t.id == c.Value {
+					return t
+				}
+			}
+		}
+		target := b.roundRobin(healthy)
+		http.SetCookie(w, &http.Cookie{
+			Name:     b.cookie,
+			Value:    target.id,
+			Path:     b.path,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return target
+	case config.PolicyHeader:
+		value := r.Header.Get(b.header)
+		if value == "" {
+			return b.roundRobin(healthy)
+		}
+		h := fnv.New32a()
+		h.Write([]byte(value))
+		return healthy[int(h.Sum32()%uint32(len(healthy)))]
+	default:
+		return b.roundRobin(healthy)
+	}
+}
+
+func (b *balancer) healthyTargets() []*upstreamTarget {
+	healthy := make([]*upstreamTarget, 0, len(b.targets))
+	for _, t := range b.targets {
+		if t.healthy.Load() {
+			healthy = append(healthy, t)
+		}
+	}
+	return healthy
+}
+
+func (b *balancer) roundRobin(targets []*upstreamTarget) *upstreamTarget {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return targets[int(n%uint64(len(targets)))]
+}
+
+func (b *balancer) leastConnections(targets []*upstreamTarget) *upstreamTarget {
+	best := targets[0]
+	bestActive := atomic.LoadInt64(&best.active)
+	for _, t := range targets[1:] {
+		if active := atomic.LoadInt64(&t.active); active < bestActive {
+			best, bestActive = t, active
+		}
+	}
+	return best
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+func newTestRoute(t *testing.T, route *config.Route) *runtimeRoute {
+	t.Helper()
+	rt, err := buildRuntimeRoute("demo", route, buildEnv{})
+	if err != nil {
+		t.Fatalf("buildRuntimeRoute returned error: %v", err)
+	}
+	return rt
+}
+
+func namedBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func serveBody(t *testing.T, rt *runtimeRoute, req *http.Request) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	rt.serveHTTP(rec, req, false)
+	return rec, rec.Body.String()
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	a := namedBackend(t, "a")
+	b := namedBackend(t, "b")
+	rt := newTestRoute(t, &config.Route{Path: "/", Upstreams: []string{a.URL, b.URL}})
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		_, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/", nil))
+		got = append(got, body)
+	}
+	if got[0] == got[1] || got[0] != got[2] || got[1] != got[3] {
+		t.Fatalf("expected alternating upstreams, got %v", got)
+	}
+}
+
+func TestBalancerStickyCookie(t *testing.T) {
+	a := namedBackend(t, "a")
+	b := namedBackend(t, "b")
+	rt := newTestRoute(t, &config.Route{
+		Path:          "/",
+		Upstreams:     []string{a.URL, b.URL},
+		LoadBalancing: &config.LoadBalancing{Policy: config.PolicyCookie},
+	})
+
+	rec, first := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != defaultStickyCookie {
+		t.Fatalf("expected sticky cookie, got %v", cookies)
+	}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/", nil)
+		req.AddCookie(cookies[0])
+		if _, body := serveBody(t, rt, req); body != first {
+			t.Fatalf("expected sticky upstream %q, got %q", first, body)
+		}
+	}
+}
+
+func TestBalancerHeaderPolicyRequiresHeader(t *testing.T) {
+	_, err := buildRuntimeRoute("demo", &config.Route{
+		Path:          "/",
+		Upstreams:     []string{"http://127.0.0.1:1", "http://127.0.0.1:2"},
+		LoadBalancing: &config.LoadBalancing{Policy: config.PolicyHeader},
+	}, buildEnv{})
+	if err == nil {
+		t.Fatal("expected error for header policy without header name")
+	}
+}
+
+func TestHealthCheckEjectsUnhealthyTarget(t *testing.T) {
+	good := namedBackend(t, "good")
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "bad")
+	}))
+	t.Cleanup(bad.Close)
+
+	rt := newTestRoute(t, &config.Route{
+		Path:      "/",
+		Upstreams: []string{good.URL, bad.URL},
+		HealthCheck: &config.HealthCheck{
+			Path:               "/healthz",
+			Interval:           config.Duration(10 * time.Millisecond),
+			UnhealthyThreshold: 1,
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startHealthChecks(ctx, map[string]*domainRouter{"demo.localhost": {routes: []*runtimeRoute{rt}}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for rt.balancer.targets[1].healthy.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("unhealthy target was not ejected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		if _, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/", nil)); body != "good" {
+			t.Fatalf("expected healthy upstream, got %q", body)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const defaultCaptureBodyBytes = 1 << 20
+
+// exchange is a captured upstream request/response pair.
+type exchange struct {
+	Project  string
+	Route    string
+	Upstream string
+	Started  time.Time
+
+	Method         string
+	URL            string
+	Proto          string
+	RequestHeader  http.Header
+	RequestBody    *capturedBody
+	Status         int
+	ResponseProto  string
+	ResponseHeader http.Header
+	ResponseBody   *capturedBody
+	Err            error
+
+	Timings exchangeTimings
+}
+
+// exchangeTimings breaks an exchange into phases. Zero durations mean the
+// phase did not happen, for example DNS on a reused connection.
+type exchangeTimings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+}
+
+// exchangeSink receives completed exchanges.
+type exchangeSink interface {
+	wants(project string) bool
+	observe(ex *exchange)
+}
+
+// trafficObserver fans captured exchanges out to its sinks.
+type trafficObserver struct {
+	maxBody int64
+	mu      sync.RWMutex
+	sinks   []exchangeSink
+}
+
+func newTrafficObserver(maxBody int64) *trafficObserver {
+	if maxBody <= 0 {
+		maxBody = defaultCaptureBodyBytes
+	}
+	return &trafficObserver{maxBody: maxBody}
+}
+
+func (o *trafficObserver) add(sink exchangeSink) {
+	o.mu.Lock()
+	o.sinks = append(o.sinks, sink)
+	o.mu.Unlock()
+}
+
+func (o *trafficObserver) wants(project string) bool {
+	if o == nil {
+		return false
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, sink := range o.sinks {
+		if sink.wants(project) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *trafficObserver) publish(ex *exchange) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, sink := range o.sinks {
+		if sink.wants(ex.Project) {
+			sink.observe(ex)
+		}
+	}
+}
+
+// captureTransport records exchanges passing through an upstream proxy.
+type captureTransport struct {
+	base     http.RoundTripper
+	observer *trafficObserver
+	project  string
+	route    string
+	upstream string
+}
+
+func newCaptureTransport(base http.RoundTripper, observer *trafficObserver, project, route, upstream string) http.RoundTripper {
+	if observer == nil {
+		return base
+	}
+	return &captureTransport{base: base, observer: observer, project: project, route: route, upstream: upstream}
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.observer.wants(t.project) {
+		return t.base.RoundTrip(req)
+	}
+	ex := &exchange{
+		Project:       t.project,
+		Route:         t.route,
+		Upstream:      t.upstream,
+		Started:       time.Now(),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		Proto:         req.Proto,
+		RequestHeader: req.Header.Clone(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body := newCapturedBody(req.Body, t.observer.maxBody, nil)
+		ex.RequestBody = body
+		req.Body = body
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timingTrace(ex.Started, &ex.Timings)))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		ex.Err = err
+		ex.Timings.Total = time.Since(ex.Started)
+		t.observer.publish(ex)
+		return nil, err
+	}
+	ex.Status = resp.StatusCode
+	ex.ResponseProto = resp.Proto
+	ex.ResponseHeader = resp.Header.Clone()
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// The body of an upgrade response is the connection itself and
+		// must stay an io.ReadWriteCloser.
+		ex.Timings.Total = time.Since(ex.Started)
+		t.observer.publish(ex)
+		return resp, nil
+	}
+	resp.Body = newCapturedBody(resp.Body, t.observer.maxBody, func() {
+		ex.Timings.Total = time.Since(ex.Started)
+		t.observer.publish(ex)
+	})
+	ex.ResponseBody = resp.Body.(*capturedBody)
+	return resp, nil
+}
+
+// timingTrace records the connection phases of a request into t. TTFB is
+// measured from start.
+func timingTrace(start time.Time, t *exchangeTimings) *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart time.Time
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			if !dnsStart.IsZero() {
+				t.DNS = time.Since(dnsStart)
+			}
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			if !connectStart.IsZero() {
+				t.Connect = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			if !tlsStart.IsZero() {
+				t.TLS = time.Since(tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() { t.TTFB = time.Since(start) },
+	}
+}
+
+// capturedBody tees up to limit bytes of a body while it is read and calls
+// done once when it is closed or fully read.
+type capturedBody struct {
+	rc        io.ReadCloser
+	limit     int64
+	buf       bytes.Buffer
+	size      int64
+	truncated bool
+	done      func()
+	once      sync.Once
+}
+
+func newCapturedBody(rc io.ReadCloser, limit int64, done func()) *capturedBody {
+	return &capturedBody{rc: rc, limit: limit, done: done}
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if n > 0 {
+		b.size += int64(n)
+		if room := b.limit - int64(b.buf.Len()); room > 0 {
+			if int64(n) > room {
+				b.buf.Write(p[:room])
+				b.truncated = true
+			} else {
+				b.buf.Write(p[:n])
+			}
+		} else {
+			b.truncated = true
+		}
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *capturedBody) Close() error {
+	err := b.rc.Close()
+	b.finish()
+	return err
+}
+
+func (b *capturedBody) finish() {
+	b.once.Do(func() {
+		if b.done != nil {
+			b.done()
+		}
+	})
+}
+
+// Bytes returns the captured prefix of the body.
+func (b *capturedBody) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.buf.Bytes()
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"local-ssl/internal/admin"
+)
+
+// controlState holds the overrides set through the control API. It is
+// shared by every router generation, so overrides survive reloads.
+type controlState struct {
+	mu       sync.RWMutex
+	drained  map[string]bool
+	disabled map[routeLabels]bool
+}
+
+func newControlState() *controlState {
+	return &controlState{drained: map[string]bool{}, disabled: map[routeLabels]bool{}}
+}
+
+func (c *controlState) isDrained(project string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.drained[project]
+}
+
+func (c *controlState) routeEnabled(project, route string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.disabled[routeLabels{project, route}]
+}
+
+func (c *controlState) drainedProjects() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var projects []string
+	for project, drained := range c.drained {
+		if drained {
+			projects = append(projects, project)
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// listenControl opens the owner-only control socket in the state directory.
+// A socket left behind by a crashed server is replaced; one answered by a
+// running server is an error.
+func (s *Server) listenControl() (net.Listener, error) {
+	path := admin.SocketPath(s.opts.StateDir)
+	if _, err := admin.Connect(s.opts.StateDir); err == nil {
+		return nil, fmt.Errorf("another devlink server is running (control socket %s)", path)
+	}
+	_ = os.Remove(path)
+	ln, err := listenSocket(path)
+	if err != nil {
+		return nil, fmt.Errorf("control socket: %w", err)
+	}
+	return ln, nil
+}
+
+func (s *Server) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", s.controlGet(func() (interface{}, error) { return s.Status(), nil }))
+	mux.HandleFunc("/v1/routes", s.controlGet(func() (interface{}, error) { return s.Routes(), nil }))
+	mux.HandleFunc("/v1/health", s.controlGet(func() (interface{}, error) { return s.UpstreamHealth(), nil }))
+	mux.HandleFunc("/v1/certs", s.controlGet(func() (interface{}, error) { return s.certs.Certificates() }))
+	mux.HandleFunc("/v1/reload", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		if err := s.reload(); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, admin.Error{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Status().LastReload)
+	})
+	mux.HandleFunc("/v1/drain", func(w http.ResponseWriter, r *http.Request) {
+		var req admin.DrainRequest
+		if !requireMethod(w, r, http.MethodPost) || !decodeControl(w, r, &req) {
+			return
+		}
+		if !s.hasProject(req.Project) {
+			writeJSON(w, http.StatusNotFound, admin.Error{Error: fmt.Sprintf("project %s is not loaded", req.Project)})
+			return
+		}
+		s.control.mu.Lock()
+		s.control.drained[req.Project] = req.Drain
+		s.control.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/v1/routes/toggle", func(w http.ResponseWriter, r *http.Request) {
+		var req admin.RouteToggle
+		if !requireMethod(w, r, http.MethodPost) || !decodeControl(w, r, &req) {
+			return
+		}
+		if !s.hasRoute(req.Project, req.Route) {
+			writeJSON(w, http.StatusNotFound, admin.Error{Error: fmt.Sprintf("project %s has no route %s", req.Project, req.Route)})
+			return
+		}
+		s.control.mu.Lock()
+		s.control.disabled[routeLabels{req.Project, req.Route}] = !req.Enabled
+		s.control.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func (s *Server) controlGet(get func() (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		v, err := get()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, admin.Error{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, admin.Error{Error: "method not allowed"})
+	return false
+}
+
+func decodeControl(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, admin.Error{Error: "invalid request: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// Status describes the running server.
+func (s *Server) Status() admin.Status {
+	status := admin.Status{
+		PID:         os.Getpid(),
+		StartedAt:   s.started,
+		ConfigPath:  s.opts.ConfigPath,
+		StateDir:    s.opts.StateDir,
+		HTTPPort:    s.opts.HTTPPort,
+		HTTPSPort:   s.opts.HTTPSPort,
+		MetricsAddr: s.opts.MetricsAddr,
+		Projects:    []string{},
+		Drained:     s.control.drainedProjects(),
+	}
+	if s.inspector != nil {
+		status.InspectorURL = inspectorURL(s.opts.HTTPSPort)
+	}
+	s.mu.RLock()
+	status.LastReload = s.lastReload
+	seen := map[string]bool{}
+	for _, dr := range s.routers {
+		if !seen[dr.project] {
+			seen[dr.project] = true
+			status.Projects = append(status.Projects, dr.project)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(status.Projects)
+	return status
+}
+
+// Routes returns the routing table, ordered by project and path.
+func (s *Server) Routes() []admin.Route {
+	s.mu.RLock()
+	domains := map[*domainRouter][]string{}
+	for host, dr := range s.routers {
+		domains[dr] = append(domains[dr], host)
+	}
+	s.mu.RUnlock()
+	routes := []admin.Route{}
+	for dr, hosts := range domains {
+		sort.Strings(hosts)
+		for _, rt := range dr.routes {
+			routes = append(routes, admin.Route{
+				Project:       dr.project,
+				Domains:       hosts,
+				Path:          rt.path,
+				Kind:          rt.kind,
+				Upstreams:     rt.upstreams(),
+				Enabled:       dr.enabled(rt),
+				Draining:      s.control.isDrained(dr.project),
+				StripPrefix:   rt.stripPrefix,
+				Websocket:     rt.websocket,
+				SpaFallback:   rt.spaFallback,
+				RetryTimeout:  durationString(rt.retryTimeout),
+				HealthTimeout: durationString(rt.healthTimeout),
+				Source:        dr.source,
+			})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Project != routes[j].Project {
+			return routes[i].Project < routes[j].Project
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+func (s *Server) hasProject(project string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, dr := range s.routers {
+		if dr.project == project {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) hasRoute(project, route string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, dr := range s.routers {
+		if dr.project != project {
+			continue
+		}
+		for _, rt := range dr.routes {
+			if rt.path == route {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordReload remembers the outcome of a reload for the status API.
+func (s *Server) recordReload(err error) {
+	reload := admin.Reload{Time: time.Now()}
+	if err != nil {
+		reload.Error = strings.TrimSpace(err.Error())
+	}
+	s.mu.Lock()
+	s.lastReload = reload
+	s.mu.Unlock()
+}
+
+// durationString formats d for the routing table, leaving unset values
+// empty.
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
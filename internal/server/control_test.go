@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"local-ssl/internal/admin"
+	"local-ssl/internal/config"
+)
+
+func TestControlAPI(t *testing.T) {
+	backend := namedBackend(t, "api")
+	frontend := namedBackend(t, "front")
+	s := &Server{opts: Options{StateDir: t.TempDir()}, control: newControlState()}
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"demo": {
+			Domains: []string{"demo.localhost"},
+			Routes: []*config.Route{
+				{Path: "/", Upstream: frontend.URL},
+				{Path: "/api", Upstream: backend.URL, Websocket: true, Retry: &config.RetryPolicy{Timeout: config.Duration(5 * time.Second)}},
+			},
+		},
+	}}
+	routers, err := buildRouters(cfg, buildEnv{control: s.control})
+	if err != nil {
+		t.Fatalf("buildRouters returned error: %v", err)
+	}
+	s.routers = routers
+
+	ln, err := s.listenControl()
+	if err != nil {
+		t.Fatalf("listenControl returned error: %v", err)
+	}
+	srv := &http.Server{Handler: s.controlHandler()}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	if _, err := s.listenControl(); err == nil {
+		t.Fatal("expected a second server to be refused")
+	}
+
+	client, err := admin.Connect(s.opts.StateDir)
+	if err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	ctx := context.Background()
+	routes, err := client.Routes(ctx)
+	if err != nil {
+		t.Fatalf("Routes returned error: %v", err)
+	}
+	if len(routes) != 2 || routes[1].Path != "/api" || routes[1].Kind != "proxy" || !routes[1].Enabled {
+		t.Fatalf("unexpected routing table: %+v", routes)
+	}
+	if r := routes[1]; !r.StripPrefix || !r.Websocket || r.SpaFallback || r.RetryTimeout != "5s" || r.HealthTimeout != "" {
+		t.Fatalf("unexpected route settings: %+v", r)
+	}
+
+	get := func() (int, string) {
+		rec := httptest.NewRecorder()
+		s.handleHTTPS(rec, httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/x", nil))
+		return rec.Code, rec.Body.String()
+	}
+	if err := client.SetRouteEnabled(ctx, "demo", "/api", false); err != nil {
+		t.Fatalf("SetRouteEnabled returned error: %v", err)
+	}
+	if _, body := get(); body != "front" {
+		t.Fatalf("expected the disabled route to fall through, got %q", body)
+	}
+	if err := client.SetRouteEnabled(ctx, "demo", "/missing", false); err == nil {
+		t.Fatal("expected an error for an unknown route")
+	}
+
+	if err := client.Drain(ctx, "demo", true); err != nil {
+		t.Fatalf("Drain returned error: %v", err)
+	}
+	if code, _ := get(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", code)
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	if len(status.Projects) != 1 || len(status.Drained) != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if err := client.Drain(ctx, "demo", false); err != nil {
+		t.Fatalf("Drain returned error: %v", err)
+	}
+	if code, _ := get(); code != http.StatusOK {
+		t.Fatalf("expected traffic to resume, got %d", code)
+	}
+}
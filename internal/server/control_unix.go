@@ -0,0 +1,17 @@
+//go:build !windows
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenSocket creates the Unix socket at path readable and writable only by
+// the owner. The mode comes from the umask at bind time, so the socket is
+// never reachable by others, as it would be until a later chmod.
+func listenSocket(path string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
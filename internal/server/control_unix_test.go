@@ -0,0 +1,30 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"local-ssl/internal/admin"
+)
+
+func TestControlSocketIsOwnerOnly(t *testing.T) {
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	s := &Server{opts: Options{StateDir: t.TempDir()}}
+	ln, err := s.listenControl()
+	if err != nil {
+		t.Fatalf("listenControl returned error: %v", err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(admin.SocketPath(s.opts.StateDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("expected the control socket to be created 0600, got %o", mode)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package server
+
+import "net"
+
+// listenSocket creates the Unix socket at path. Windows has no umask; the
+// socket inherits the ACL of the state directory, by default inside the
+// user's profile.
+func listenSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// devlinkPathPrefix is reserved on every project domain for gateway
+// endpoints such as the upstream readiness probe.
+const devlinkPathPrefix = "/__devlink/"
+
+const upstreamProbePath = devlinkPathPrefix + "upstream"
+
+//go:embed assets/upstream-error.html
+var upstreamErrorHTML string
+
+var upstreamErrorTemplate = template.Must(template.New("upstream-error").Parse(upstreamErrorHTML))
+
+// upstreamError describes a failed attempt to reach a route's upstream.
+type upstreamError struct {
+	Error    string `json:"error"`
+	Project  string `json:"project"`
+	Route    string `json:"route"`
+	Upstream string `json:"upstream"`
+	Detail   string `json:"detail"`
+	ProbeURL string `json:"-"`
+}
+
+// writeUpstreamError renders an interstitial page for browsers, which polls
+// the readiness probe and reloads once the upstream is reachable, and a JSON
+// document for every other client.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, status int, e upstreamError) {
+	e.ProbeURL = upstreamProbePath + "?route=" + url.QueryEscape(e.Route)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Devlink-Error", e.Error)
+	if wantsHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if err := upstreamErrorTemplate.Execute(w, e); err != nil {
+			log.Printf("render upstream error page: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// serveUpstreamProbe reports whether the requested route passed its readiness
+// gate and any of its upstreams currently accepts connections.
+func (dr *domainRouter) serveUpstreamProbe(w http.ResponseWriter, r *http.Request) {
+	routePath := r.URL.Query().Get("route")
+	var route *runtimeRoute
+	for _, rt := range dr.routes {
+		if rt.path == routePath {
+			route = rt
+			break
+		}
+	}
+	if route == nil {
+		http.Error(w, "unknown route", http.StatusNotFound)
+		return
+	}
+	ready := len(route.targets()) == 0 && !dr.control.isDrained(dr.project)
+	if !ready && route.isReady() && !dr.control.isDrained(dr.project) {
+		for _, target := range route.targets() {
+			if target.reachable(r) {
+				ready = true
+				break
+			}
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]bool{"ready": ready})
+}
+
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
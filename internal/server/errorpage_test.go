@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+// closedUpstream returns the URL of a loopback port with nothing listening.
+func closedUpstream(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func TestUpstreamErrorJSON(t *testing.T) {
+	upstream := closedUpstream(t)
+	rt := newTestRoute(t, &config.Route{Path: "/api", Upstream: upstream})
+
+	req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/users", nil)
+	req.Header.Set("Accept", "application/json")
+	rec, _ := serveBody(t, rt, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", rec.Code)
+	}
+	var body upstreamError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Project != "demo" || body.Route != "/api" || body.Upstream != upstream || body.Detail == "" {
+		t.Fatalf("unexpected error body %+v", body)
+	}
+}
+
+func TestUpstreamErrorHTML(t *testing.T) {
+	rt := newTestRoute(t, &config.Route{Path: "/", Upstream: closedUpstream(t)})
+
+	req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec, body := serveBody(t, rt, req)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected HTML response, got %q", ct)
+	}
+	if !strings.Contains(body, upstreamProbePath) || !strings.Contains(body, "demo") {
+		t.Fatalf("interstitial is missing project or probe URL:\n%s", body)
+	}
+}
+
+func TestUpstreamProbe(t *testing.T) {
+	up := namedBackend(t, "up")
+	dr, err := newDomainRouter("demo", &config.Project{Routes: []*config.Route{
+		{Path: "/", Upstream: up.URL},
+		{Path: "/api", Upstream: closedUpstream(t)},
+	}}, buildEnv{})
+	if err != nil {
+		t.Fatalf("newDomainRouter returned error: %v", err)
+	}
+	for route, want := range map[string]bool{"/": true, "/api": false} {
+		rec := httptest.NewRecorder()
+		dr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://demo.localhost"+upstreamProbePath+"?route="+route, nil))
+		var state map[string]bool
+		if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+			t.Fatalf("decode probe response: %v", err)
+		}
+		if state["ready"] != want {
+			t.Fatalf("route %s: expected ready=%t, got %t", route, want, state["ready"])
+		}
+	}
+}
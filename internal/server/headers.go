@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"local-ssl/internal/config"
+)
+
+// headerRules are the compiled header rules of a route, project rules
+// first.
+type headerRules struct {
+	request  []headerRule
+	response []headerRule
+}
+
+type headerRule struct {
+	// action is set, add, remove or rename.
+	action string
+	name   string
+	to     string
+	// value is nil for static values.
+	value  *template.Template
+	static string
+}
+
+// headerData is the data available to header value templates.
+type headerData struct {
+	// ClientIP is the address of the client connected to the gateway.
+	ClientIP string
+	// Host is the requested host without port, and Label its first label,
+	// e.g. acme for acme.shop.localhost.
+	Host  string
+	Label string
+	// Project and Route name the matched project and route path.
+	Project string
+	Route   string
+	Method  string
+	// Path is the request path before the route prefix is stripped.
+	Path string
+	// Header holds the request headers, e.g. {{.Header.Get "Cookie"}}.
+	Header http.Header
+	// Status is the response status in response rules.
+	Status int
+}
+
+// newHeaderRules compiles the rules of a project and a route. It returns
+// nil when neither has any.
+func newHeaderRules(layers ...*config.Headers) (*headerRules, error) {
+	rules := &headerRules{}
+	for _, h := range layers {
+		if h == nil {
+			continue
+		}
+		for _, list := range []struct {
+			name  string
+			rules []*config.HeaderRule
+			into  *[]headerRule
+		}{{"request", h.Request, &rules.request}, {"response", h.Response, &rules.response}} {
+			for i, r := range list.rules {
+				rule, err := compileHeaderRule(r)
+				if err != nil {
+					return nil, fmt.Errorf("headers.%s[%d]: %w", list.name, i, err)
+				}
+				*list.into = append(*list.into, rule)
+			}
+		}
+	}
+	if len(rules.request) == 0 && len(rules.response) == 0 {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+func compileHeaderRule(r *config.HeaderRule) (headerRule, error) {
+	if r == nil {
+		return headerRule{}, fmt.Errorf("rule is empty")
+	}
+	switch {
+	case r.Set != "":
+		return compileValueRule("set", r.Set, r.Value)
+	case r.Add != "":
+		return compileValueRule("add", r.Add, r.Value)
+	case r.Remove != "":
+		return headerRule{action: "remove", name: r.Remove}, nil
+	case r.Rename != "":
+		return headerRule{action: "rename", name: r.Rename, to: r.To}, nil
+	}
+	return headerRule{}, fmt.Errorf("rule has no action")
+}
+
+func compileValueRule(action, name, value string) (headerRule, error) {
+	rule := headerRule{action: action, name: name, static: value}
+	if !strings.Contains(value, "{{") {
+		return rule, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(value)
+	if err != nil {
+		return headerRule{}, fmt.Errorf("parse value of %s: %w", name, err)
+	}
+	// Catch references to unknown fields when the route is built rather
+	// than on every request.
+	if err := tmpl.Execute(&strings.Builder{}, &headerData{Header: http.Header{}}); err != nil {
+		return headerRule{}, fmt.Errorf("value of %s: %w", name, err)
+	}
+	rule.value = tmpl
+	return rule, nil
+}
+
+// applyHeaderRules runs rules against header, in order.
+func applyHeaderRules(rules []headerRule, header http.Header, data *headerData) {
+	for _, rule := range rules {
+		switch rule.action {
+		case "set", "add":
+			value := rule.static
+			if rule.value != nil {
+				var b strings.Builder
+				if err := rule.value.Execute(&b, data); err != nil {
+					log.Printf("header template for %s: %v", rule.name, err)
+					continue
+				}
+				value = b.String()
+			}
+			if rule.action == "set" {
+				header.Set(rule.name, value)
+			} else {
+				header.Add(rule.name, value)
+			}
+		case "remove":
+			prefix, wildcard := strings.CutSuffix(http.CanonicalHeaderKey(rule.name), "*")
+			if !wildcard {
+				header.Del(rule.name)
+				continue
+			}
+			for key := range header {
+				if strings.HasPrefix(http.CanonicalHeaderKey(key), prefix) {
+					delete(header, key)
+				}
+			}
+		case "rename":
+			values := header.Values(rule.name)
+			if len(values) == 0 {
+				continue
+			}
+			header.Del(rule.name)
+			for _, v := range values {
+				header.Add(rule.to, v)
+			}
+		}
+	}
+}
+
+// newHeaderData describes a request matched by rt for header templates.
+func newHeaderData(r *http.Request, rt *runtimeRoute, path string) *headerData {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	host := hostOnly(r.Host)
+	label, _, _ := strings.Cut(host, ".")
+	return &headerData{
+		ClientIP: clientIP,
+		Host:     host,
+		Label:    label,
+		Project:  rt.project,
+		Route:    rt.path,
+		Method:   r.Method,
+		Path:     path,
+		Header:   r.Header,
+	}
+}
+
+// headerContext carries the rules of a proxied request to the proxy's
+// director, which applies them after its own headers.
+type headerContext struct {
+	rules *headerRules
+	data  *headerData
+}
+
+type headerContextKey struct{}
+
+func withHeaderContext(ctx context.Context, hc *headerContext) context.Context {
+	return context.WithValue(ctx, headerContextKey{}, hc)
+}
+
+func headerContextFrom(ctx context.Context) *headerContext {
+	hc, _ := ctx.Value(headerContextKey{}).(*headerContext)
+	return hc
+}
+
+// headerWriter applies response rules before the response header is
+// written.
+type headerWriter struct {
+	http.ResponseWriter
+	rules       []headerRule
+	data        *headerData
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= 200 {
+		w.wroteHeader = true
+		data := *w.data
+		data.Status = status
+		applyHeaderRules(w.rules, w.Header(), &data)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush supports streaming responses such as server-sent events.
+func (w *headerWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
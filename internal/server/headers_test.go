@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+func TestHeaderRulesRewriteProxiedRequestsAndResponses(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "framework")
+		w.Header().Set("X-Powered-Version", "1.0")
+		w.Header().Set("X-Internal", "secret")
+		json.NewEncoder(w).Encode(r.Header)
+	}))
+	t.Cleanup(backend.Close)
+
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"shop": {
+			Domains: []string{"acme.shop.localhost"},
+			Headers: &config.Headers{
+				Request: []*config.HeaderRule{
+					{Set: "X-Tenant-ID", Value: "{{.Label}}"},
+					{Remove: "Authorization"},
+				},
+				Response: []*config.HeaderRule{{Remove: "X-Powered-*"}},
+			},
+			Routes: []*config.Route{{
+				Path:     "/api",
+				Upstream: backend.URL,
+				Headers: &config.Headers{
+					Request: []*config.HeaderRule{
+						{Add: "X-Auth-Context", Value: "{{.Method}} {{.Route}} {{.Path}} from {{.ClientIP}}"},
+						{Rename: "X-Legacy", To: "X-Modern"},
+						{Set: "X-Forwarded-Host", Value: "shop.example.com"},
+					},
+					Response: []*config.HeaderRule{
+						{Rename: "X-Internal", To: "X-Debug-Internal"},
+						{Set: "X-Route-Status", Value: "{{.Route}} {{.Status}}"},
+					},
+				},
+			}},
+		},
+	}}
+	routers, err := buildRouters(cfg, buildEnv{control: newControlState()})
+	if err != nil {
+		t.Fatalf("buildRouters returned error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://acme.shop.localhost/api/orders", nil)
+	req.RemoteAddr = "192.0.2.7:5555"
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Legacy", "v1")
+	rec := httptest.NewRecorder()
+	routers["acme.shop.localhost"].ServeHTTP(rec, req)
+
+	var got http.Header
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"X-Tenant-Id":      "acme",
+		"Authorization":    "",
+		"X-Auth-Context":   "GET /api /api/orders from 192.0.2.7",
+		"X-Legacy":         "",
+		"X-Modern":         "v1",
+		"X-Forwarded-Host": "shop.example.com",
+	} {
+		if v := got.Get(name); v != want {
+			t.Errorf("request header %s: expected %q, got %q", name, want, v)
+		}
+	}
+	for name, want := range map[string]string{
+		"X-Powered-By":      "",
+		"X-Powered-Version": "",
+		"X-Internal":        "",
+		"X-Debug-Internal":  "secret",
+		"X-Route-Status":    "/api 200",
+	} {
+		if v := rec.Header().Get(name); v != want {
+			t.Errorf("response header %s: expected %q, got %q", name, want, v)
+		}
+	}
+}
+
+func TestHeaderRulesApplyToStaticRoutes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"docs": {
+			Domains: []string{"docs.localhost"},
+			Routes: []*config.Route{{
+				Path: "/",
+				Root: dir,
+				Headers: &config.Headers{Response: []*config.HeaderRule{
+					{Set: "Cache-Control", Value: "no-store"},
+				}},
+			}},
+		},
+	}}
+	routers, err := buildRouters(cfg, buildEnv{control: newControlState()})
+	if err != nil {
+		t.Fatalf("buildRouters returned error: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	routers["docs.localhost"].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://docs.localhost/", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the response rule on a static route, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestHeaderRulesRejectUnknownTemplateFields(t *testing.T) {
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"demo": {
+			Domains: []string{"demo.localhost"},
+			Headers: &config.Headers{Request: []*config.HeaderRule{{Set: "X-User", Value: "{{.User}}"}}},
+			Routes:  []*config.Route{{Path: "/", Upstream: "http://127.0.0.1:1"}},
+		},
+	}}
+	if _, err := buildRouters(cfg, buildEnv{control: newControlState()}); err == nil {
+		t.Fatal("expected an error for an unknown template field")
+	}
+}
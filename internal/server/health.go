@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+const (
+	defaultHealthInterval  = 10 * time.Second
+	defaultHealthTimeout   = 2 * time.Second
+	defaultUnhealthyThresh = 2
+	defaultHealthyThresh   = 1
+)
+
+// healthChecker actively probes the targets of a single route.
+type healthChecker struct {
+	project            string
+	route              string
+	path               string
+	interval           time.Duration
+	timeout            time.Duration
+	expectStatus       int
+	unhealthyThreshold int
+	healthyThreshold   int
+}
+
+func newHealthChecker(project, route string, hc *config.HealthCheck) *healthChecker {
+	if hc == nil {
+		return nil
+	}
+	c := &healthChecker{
+		project:            project,
+		route:              route,
+		path:               hc.Path,
+		interval:           hc.Interval.Std(),
+		timeout:            hc.Timeout.Std(),
+		expectStatus:       hc.ExpectStatus,
+		unhealthyThreshold: hc.UnhealthyThreshold,
+		healthyThreshold:   hc.HealthyThreshold,
+	}
+	if c.path == "" {
+		c.path = "/"
+	}
+	if !strings.HasPrefix(c.path, "/") {
+		c.path = "/" + c.path
+	}
+	if c.interval <= 0 {
+		c.interval = defaultHealthInterval
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultHealthTimeout
+	}
+	if c.unhealthyThreshold <= 0 {
+		c.unhealthyThreshold = defaultUnhealthyThresh
+	}
+	if c.healthyThreshold <= 0 {
+		c.healthyThreshold = defaultHealthyThresh
+	}
+	return c
+}
+
+// run probes target until ctx is cancelled, flipping its health flag once
+// the configured number of consecutive probes agree.
+func (c *healthChecker) run(ctx context.Context, target *upstreamTarget) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	successes, failures := 0, 0
+	for {
+		err := c.probe(ctx, target)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			successes++
+			failures = 0
+			if !target.healthy.Load() && successes >= c.healthyThreshold {
+				target.healthy.Store(true)
+				log.Printf("upstream %s for %s%s is healthy", target.raw, c.project, c.route)
+			}
+		} else {
+			failures++
+			successes = 0
+			if target.healthy.Load() && failures >= c.unhealthyThreshold {
+				target.healthy.Store(false)
+				log.Printf("upstream %s for %s%s is unhealthy: %v", target.raw, c.project, c.route, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *healthChecker) probe(ctx context.Context, target *upstreamTarget) error {
+	u := *target.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + c.path
+	u.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "devlink-health-check")
+	client := &http.Client{
+		Transport: target.transport,
+		Timeout:   c.timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if c.expectStatus != 0 {
+		if resp.StatusCode != c.expectStatus {
+			return fmt.Errorf("status %d, expected %d", resp.StatusCode, c.expectStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"local-ssl/internal/config"
+)
+
+// InspectorHost is the reserved domain serving the traffic inspector.
+const InspectorHost = config.ReservedDomain
+
+const (
+	inspectorHistory = 500
+	inspectorMaxBody = 64 << 10
+	// inspectorReplayTimeout bounds a replayed request, which no client
+	// waits for.
+	inspectorReplayTimeout = 30 * time.Second
+)
+
+//go:embed assets/inspector.html
+var inspectorHTML []byte
+
+// inspectedRequest is a request seen by the gateway, as shown by the
+// inspector.
+type inspectedRequest struct {
+	ID              uint64              `json:"id"`
+	Time            time.Time           `json:"time"`
+	Host            string              `json:"host"`
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	Project         string              `json:"project"`
+	Route           string              `json:"route"`
+	OriginalPath    string              `json:"originalPath"`
+	RewrittenPath   string              `json:"rewrittenPath"`
+	Upstream        string              `json:"upstream"`
+	Fallback        bool                `json:"fallback"`
+	Status          int                 `json:"status"`
+	Bytes           int64               `json:"bytes"`
+	Timings         inspectedTimings    `json:"timings"`
+	RequestHeaders  map[string][]string `json:"requestHeaders,omitempty"`
+	RequestBody     string              `json:"requestBody,omitempty"`
+	RequestBodyCut  bool                `json:"requestBodyTruncated,omitempty"`
+	ResponseHeaders map[string][]string `json:"responseHeaders,omitempty"`
+	ResponseBody    string              `json:"responseBody,omitempty"`
+	ResponseBodyCut bool                `json:"responseBodyTruncated,omitempty"`
+
+	// rawRequestHeader holds the headers before redaction, for replay.
+	rawRequestHeader http.Header
+	rawRequestBody   []byte
+}
+
+// inspectedTimings are durations in milliseconds.
+type inspectedTimings struct {
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	TLS     float64 `json:"tls"`
+	TTFB    float64 `json:"ttfb"`
+	Total   float64 `json:"total"`
+}
+
+// summary omits headers and bodies for list and stream views.
+func (r *inspectedRequest) summary() *inspectedRequest {
+	s := *r
+	s.RequestHeaders, s.RequestBody, s.ResponseHeaders, s.ResponseBody = nil, "", nil, ""
+	return &s
+}
+
+// inspector keeps recent requests in memory and streams them to the UI.
+type inspector struct {
+	// origin is the inspector's own origin, the only one allowed to replay.
+	origin string
+	replay func(*http.Request)
+	// ctx is cancelled by close to abort replays in flight.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	replays sync.WaitGroup
+
+	mu          sync.Mutex
+	nextID      uint64
+	requests    []*inspectedRequest
+	subscribers map[chan *inspectedRequest]struct{}
+}
+
+func newInspector(origin string, replay func(*http.Request)) *inspector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &inspector{origin: origin, replay: replay, ctx: ctx, cancel: cancel, subscribers: map[chan *inspectedRequest]struct{}{}}
+}
+
+// close aborts the replays in flight and waits for them to finish.
+func (in *inspector) close() {
+	in.cancel()
+	in.replays.Wait()
+}
+
+func (in *inspector) add(r *inspectedRequest) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.nextID++
+	r.ID = in.nextID
+	in.requests = append(in.requests, r)
+	if len(in.requests) > inspectorHistory {
+		in.requests = in.requests[len(in.requests)-inspectorHistory:]
+	}
+	summary := r.summary()
+	for ch := range in.subscribers {
+		select {
+		case ch <- summary:
+		default:
+			// Slow subscribers miss updates rather than block requests.
+		}
+	}
+}
+
+func (in *inspector) get(id uint64) *inspectedRequest {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, r := range in.requests {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// record converts a finished request into an inspector entry. Credentials
+// are masked as in HAR recordings.
+func (in *inspector) record(info *requestInfo, r *http.Request, reqHeader http.Header, reqBody *capturedBody, sw *statusWriter) {
+	entry := &inspectedRequest{
+		Time:            info.Start,
+		Host:            info.Host,
+		Method:          info.Method,
+		URL:             "https://" + r.Host + info.RequestURI,
+		Project:         info.Project,
+		Route:           info.Route,
+		OriginalPath:    info.OriginalPath,
+		RewrittenPath:   info.RewrittenPath,
+		Upstream:        info.Upstream,
+		Fallback:        info.Fallback,
+		Status:          sw.Status(),
+		Bytes:           sw.bytes,
+		RequestHeaders:  redactHeader(reqHeader),
+		ResponseHeaders: redactHeader(sw.Header()),
+		ResponseBody:    displayBody(sw.body.Bytes()),
+		ResponseBodyCut: sw.truncated,
+		Timings: inspectedTimings{
+			DNS:     millis(info.Timings.DNS),
+			Connect: millis(info.Timings.Connect),
+			TLS:     millis(info.Timings.TLS),
+			TTFB:    millis(info.Timings.TTFB),
+			Total:   millis(time.Since(info.Start)),
+		},
+		rawRequestHeader: reqHeader,
+	}
+	if reqBody != nil {
+		entry.rawRequestBody = append([]byte(nil), reqBody.Bytes()...)
+		entry.RequestBody = displayBody(entry.rawRequestBody)
+		entry.RequestBodyCut = reqBody.truncated
+	}
+	in.add(entry)
+}
+
+// redactHeader returns a copy of h with DefaultRedactedHeaders masked.
+func redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range DefaultRedactedHeaders {
+		values := out[http.CanonicalHeaderKey(name)]
+		for i := range values {
+			values[i] = redactedValue
+		}
+	}
+	return out
+}
+
+func displayBody(body []byte) string {
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	return fmt.Sprintf("<%d bytes of binary data>", len(body))
+}
+
+func (in *inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(inspectorHTML)
+	case r.URL.Path == "/api/requests":
+		in.serveList(w, r)
+	case r.URL.Path == "/api/events":
+		in.serveEvents(w, r)
+	case strings.HasPrefix(r.URL.Path, "/api/requests/"):
+		in.serveRequest(w, r, strings.TrimPrefix(r.URL.Path, "/api/requests/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (in *inspector) serveList(w http.ResponseWriter, r *http.Request) {
+	project := r.URL.Query().Get("project")
+	in.mu.Lock()
+	list := make([]*inspectedRequest, 0, len(in.requests))
+	for _, req := range in.requests {
+		if project == "" || req.Project == project {
+			list = append(list, req.summary())
+		}
+	}
+	in.mu.Unlock()
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (in *inspector) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan *inspectedRequest, 64)
+	in.mu.Lock()
+	in.subscribers[ch] = struct{}{}
+	in.mu.Unlock()
+	defer func() {
+		in.mu.Lock()
+		delete(in.subscribers, ch)
+		in.mu.Unlock()
+	}()
+
+	// Streams outlive the server's write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case req := <-ch:
+			data, _ := json.Marshal(req)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (in *inspector) serveRequest(w http.ResponseWriter, r *http.Request, rest string) {
+	idPart, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	req := in.get(id)
+	if req == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch action {
+	case "":
+		writeJSON(w, http.StatusOK, req)
+	case "curl":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, curlCommand(req))
+	case "replay":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Any page may POST here; only the inspector UI itself may replay.
+		if r.Header.Get("Origin") != in.origin {
+			http.Error(w, "replay is only allowed from the inspector", http.StatusForbidden)
+			return
+		}
+		replayed, err := req.newRequest()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The result shows up in the request list; slow or streaming
+		// responses must not hold the UI call.
+		ctx, cancel := context.WithTimeout(in.ctx, inspectorReplayTimeout)
+		in.replays.Add(1)
+		go func() {
+			defer in.replays.Done()
+			defer cancel()
+			in.replay(replayed.WithContext(ctx))
+		}()
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "replaying"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newRequest rebuilds the captured request for replay through the gateway.
+func (r *inspectedRequest) newRequest() (*http.Request, error) {
+	if r.RequestBodyCut {
+		return nil, fmt.Errorf("request body was truncated and cannot be replayed")
+	}
+	req, err := http.NewRequest(r.Method, r.URL, bytes.NewReader(r.rawRequestBody))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.rawRequestHeader {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	return req, nil
+}
+
+// curlCommand renders the request as a curl invocation.
+func curlCommand(r *inspectedRequest) string {
+	var b strings.Builder
+	b.WriteString("curl")
+	if r.Method != http.MethodGet {
+		b.WriteString(" -X " + r.Method)
+	}
+	b.WriteString(" " + shellQuote(r.URL))
+	keys := make([]string, 0, len(r.RequestHeaders))
+	for key := range r.RequestHeaders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, v := range r.RequestHeaders[key] {
+			b.WriteString(" \\\n  -H " + shellQuote(key+": "+v))
+		}
+	}
+	if len(r.rawRequestBody) > 0 {
+		b.WriteString(" \\\n  --data-binary " + shellQuote(string(r.rawRequestBody)))
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// discardWriter is the response writer of replayed requests; the response
+// is only observed through the inspector.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w *discardWriter) WriteHeader(int) {}
+
+// inspectorURL returns the URL of the inspector for the given HTTPS port.
+func inspectorURL(httpsPort int) string {
+	u := url.URL{Scheme: "https", Host: InspectorHost}
+	if httpsPort != 443 {
+		u.Host = fmt.Sprintf("%s:%d", InspectorHost, httpsPort)
+	}
+	return u.String()
+}
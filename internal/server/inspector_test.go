@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+func newInspectorTestServer(t *testing.T, upstream string) *Server {
+	t.Helper()
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"demo": {
+			Domains: []string{"demo.localhost"},
+			Routes:  []*config.Route{{Path: "/api", Upstream: upstream}},
+		},
+	}}
+	routers, err := buildRouters(cfg, buildEnv{})
+	if err != nil {
+		t.Fatalf("buildRouters returned error: %v", err)
+	}
+	s := &Server{routers: routers}
+	s.inspector = newInspector(inspectorURL(443), func(r *http.Request) {
+		s.handleHTTPS(&discardWriter{}, r)
+	})
+	return s
+}
+
+func inspectorGet(t *testing.T, s *Server, path string, v interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleHTTPS(rec, httptest.NewRequest(http.MethodGet, "https://"+InspectorHost+path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+func inspectorReplay(s *Server, id, origin string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "https://"+InspectorHost+"/api/requests/"+id+"/replay", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	s.handleHTTPS(rec, req)
+	return rec
+}
+
+func TestInspectorRecordsRequests(t *testing.T) {
+	var bodies, tokens []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created "+r.URL.Path)
+	}))
+	t.Cleanup(backend.Close)
+	s := newInspectorTestServer(t, backend.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "https://demo.localhost/api/items?x=1", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	s.handleHTTPS(httptest.NewRecorder(), req)
+
+	var list []inspectedRequest
+	inspectorGet(t, s, "/api/requests?project=demo", &list)
+	if len(list) != 1 {
+		t.Fatalf("expected one request, got %d", len(list))
+	}
+	if got := list[0]; got.Status != http.StatusCreated || got.Route != "/api" || got.RewrittenPath != "/items" || got.Upstream != backend.URL {
+		t.Fatalf("unexpected summary: %+v", got)
+	}
+
+	var entry inspectedRequest
+	inspectorGet(t, s, "/api/requests/1", &entry)
+	if entry.RequestBody != `{"name":"a"}` || entry.ResponseBody != "created /items" {
+		t.Fatalf("unexpected bodies: %q / %q", entry.RequestBody, entry.ResponseBody)
+	}
+	if got := entry.RequestHeaders["Authorization"]; len(got) != 1 || got[0] != redactedValue {
+		t.Fatalf("expected the Authorization header to be redacted, got %q", got)
+	}
+	if got := entry.ResponseHeaders["Set-Cookie"]; len(got) != 1 || got[0] != redactedValue {
+		t.Fatalf("expected the Set-Cookie header to be redacted, got %q", got)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleHTTPS(rec, httptest.NewRequest(http.MethodGet, "https://"+InspectorHost+"/api/requests/1/curl", nil))
+	curl := rec.Body.String()
+	if !strings.Contains(curl, "-X POST 'https://demo.localhost/api/items?x=1'") || !strings.Contains(curl, `--data-binary '{"name":"a"}'`) {
+		t.Fatalf("unexpected curl command: %s", curl)
+	}
+
+	if strings.Contains(curl, "Bearer token") {
+		t.Fatalf("expected the curl command to be redacted: %s", curl)
+	}
+
+	if rec := inspectorReplay(s, "1", "https://"+InspectorHost); rec.Code != http.StatusAccepted {
+		t.Fatalf("replay: status %d", rec.Code)
+	}
+	waitFor(t, "the replay to be recorded", func() bool { return s.inspector.get(2) != nil })
+	if len(bodies) != 2 || bodies[1] != `{"name":"a"}` || tokens[1] != "Bearer token" {
+		t.Fatalf("expected replayed body and credentials, got %q %q", bodies, tokens)
+	}
+	inspectorGet(t, s, "/api/requests", &list)
+	if len(list) != 2 {
+		t.Fatalf("expected replay to be recorded, got %d requests", len(list))
+	}
+}
+
+func TestInspectorDomainIsReserved(t *testing.T) {
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"demo": {
+			Domains: []string{InspectorHost},
+			Routes:  []*config.Route{{Path: "/", Upstream: "http://127.0.0.1:1"}},
+		},
+	}}
+	if _, err := buildRouters(cfg, buildEnv{}); err == nil {
+		t.Fatal("expected the inspector domain to be rejected")
+	}
+}
+
+func TestInspectorRefusesCrossOriginReplay(t *testing.T) {
+	var hits int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	t.Cleanup(backend.Close)
+	s := newInspectorTestServer(t, backend.URL)
+	s.handleHTTPS(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "https://demo.localhost/api/items", nil))
+
+	for _, origin := range []string{"", "https://evil.example", "http://" + InspectorHost, "https://demo.localhost"} {
+		if rec := inspectorReplay(s, "1", origin); rec.Code != http.StatusForbidden {
+			t.Errorf("replay from origin %q: expected 403, got %d", origin, rec.Code)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expected no replayed requests, got %d", hits-1)
+	}
+}
+
+func TestInspectorReplayDoesNotWaitForResponse(t *testing.T) {
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			return
+		}
+		// The replay hangs like a long poll until it is cancelled.
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	t.Cleanup(backend.Close)
+	s := newInspectorTestServer(t, backend.URL)
+	s.handleHTTPS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/stream", nil))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- inspectorReplay(s, "1", "https://"+InspectorHost) }()
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("replay: status %d", rec.Code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected replay to answer before the upstream responds")
+	}
+
+	waitFor(t, "the replay to reach the upstream", func() bool { return calls.Load() == 2 })
+	s.inspector.close()
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected closing the inspector to cancel the replayed request")
+	}
+}
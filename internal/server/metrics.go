@@ -0,0 +1,305 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"local-ssl/internal/certs"
+)
+
+// defaultBuckets are the latency histogram buckets in seconds.
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics collects gateway metrics and renders them in the Prometheus text
+// exposition format. A nil *metrics discards observations.
+type metrics struct {
+	certs *certs.Manager
+
+	mu         sync.Mutex
+	requests   map[requestLabels]*histogram
+	upstreams  map[upstreamLabels]*histogram
+	dialErrors map[upstreamLabels]uint64
+	websockets map[routeLabels]int64
+	reloads    map[string]uint64
+}
+
+type requestLabels struct {
+	project, domain, route, code string
+}
+
+type upstreamLabels struct {
+	project, route, upstream string
+}
+
+type routeLabels struct {
+	project, route string
+}
+
+func newMetrics(mgr *certs.Manager) *metrics {
+	return &metrics{
+		certs:      mgr,
+		requests:   map[requestLabels]*histogram{},
+		upstreams:  map[upstreamLabels]*histogram{},
+		dialErrors: map[upstreamLabels]uint64{},
+		websockets: map[routeLabels]int64{},
+		reloads:    map[string]uint64{"success": 0, "failure": 0},
+	}
+}
+
+func (m *metrics) observeRequest(info *requestInfo, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	// Any Host header reaches the gateway, so only configured domains become
+	// label values.
+	domain := info.Domain
+	if info.Project == "" {
+		domain = "unmatched"
+	}
+	key := requestLabels{info.Project, domain, info.Route, statusClass(status)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.requests[key]
+	if h == nil {
+		h = newHistogram()
+		m.requests[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (m *metrics) observeUpstream(project, route, upstream string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	key := upstreamLabels{project, route, upstream}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		if isDialError(err) {
+			m.dialErrors[key]++
+		}
+		return
+	}
+	h := m.upstreams[key]
+	if h == nil {
+		h = newHistogram()
+		m.upstreams[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// trackWebsocket counts an open WebSocket connection until the returned
+// function is called.
+func (m *metrics) trackWebsocket(project, route string) func() {
+	if m == nil {
+		return func() {}
+	}
+	key := routeLabels{project, route}
+	m.mu.Lock()
+	m.websockets[key]++
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		m.websockets[key]--
+		m.mu.Unlock()
+	}
+}
+
+func (m *metrics) observeReload(err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.mu.Lock()
+	m.reloads[result]++
+	m.mu.Unlock()
+}
+
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write renders every metric family, ordering series by their labels.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	family(w, "devlink_requests_total", "counter", "Requests handled by the gateway.")
+	requestKeys := make([]requestLabels, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		return labelString("project", a.project, "domain", a.domain, "route", a.route, "code", a.code) <
+			labelString("project", b.project, "domain", b.domain, "route", b.route, "code", b.code)
+	})
+	for _, key := range requestKeys {
+		labels := labelString("project", key.project, "domain", key.domain, "route", key.route, "code", key.code)
+		fmt.Fprintf(w, "devlink_requests_total%s %d\n", labels, m.requests[key].count)
+	}
+
+	family(w, "devlink_request_duration_seconds", "histogram", "Time to serve requests.")
+	for _, key := range requestKeys {
+		m.requests[key].write(w, "devlink_request_duration_seconds",
+			"project", key.project, "domain", key.domain, "route", key.route, "code", key.code)
+	}
+
+	upstreamKeys := make([]upstreamLabels, 0, len(m.upstreams)+len(m.dialErrors))
+	seen := map[upstreamLabels]bool{}
+	for key := range m.upstreams {
+		upstreamKeys, seen[key] = append(upstreamKeys, key), true
+	}
+	for key := range m.dialErrors {
+		if !seen[key] {
+			upstreamKeys = append(upstreamKeys, key)
+		}
+	}
+	sort.Slice(upstreamKeys, func(i, j int) bool {
+		a, b := upstreamKeys[i], upstreamKeys[j]
+		if a.project != b.project {
+			return a.project < b.project
+		}
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		return a.upstream < b.upstream
+	})
+	family(w, "devlink_upstream_duration_seconds", "histogram", "Time until upstreams return response headers.")
+	for _, key := range upstreamKeys {
+		if h := m.upstreams[key]; h != nil {
+			h.write(w, "devlink_upstream_duration_seconds", "project", key.project, "route", key.route, "upstream", key.upstream)
+		}
+	}
+	family(w, "devlink_upstream_dial_errors_total", "counter", "Failed connection attempts to upstreams.")
+	for _, key := range upstreamKeys {
+		fmt.Fprintf(w, "devlink_upstream_dial_errors_total%s %d\n",
+			labelString("project", key.project, "route", key.route, "upstream", key.upstream), m.dialErrors[key])
+	}
+
+	family(w, "devlink_websocket_connections", "gauge", "Open proxied WebSocket connections.")
+	wsKeys := make([]routeLabels, 0, len(m.websockets))
+	for key := range m.websockets {
+		wsKeys = append(wsKeys, key)
+	}
+	sort.Slice(wsKeys, func(i, j int) bool {
+		if wsKeys[i].project != wsKeys[j].project {
+			return wsKeys[i].project < wsKeys[j].project
+		}
+		return wsKeys[i].route < wsKeys[j].route
+	})
+	for _, key := range wsKeys {
+		fmt.Fprintf(w, "devlink_websocket_connections%s %d\n", labelString("project", key.project, "route", key.route), m.websockets[key])
+	}
+
+	family(w, "devlink_config_reloads_total", "counter", "Configuration reloads by result.")
+	for _, result := range []string{"failure", "success"} {
+		fmt.Fprintf(w, "devlink_config_reloads_total%s %d\n", labelString("result", result), m.reloads[result])
+	}
+
+	if m.certs != nil {
+		family(w, "devlink_certificate_expiry_timestamp_seconds", "gauge", "Expiry time of the gateway certificates.")
+		infos, err := m.certs.Certificates()
+		if err != nil {
+			fmt.Fprintf(w, "# error reading certificates: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		}
+		for _, info := range infos {
+			fmt.Fprintf(w, "devlink_certificate_expiry_timestamp_seconds%s %d\n", labelString("name", info.Name), info.NotAfter.Unix())
+		}
+	}
+}
+
+func family(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelString renders name/value pairs as a Prometheus label set.
+func labelString(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type histogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: make([]uint64, len(defaultBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range defaultBuckets {
+		if v <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name string, labels ...string) {
+	for i, bound := range defaultBuckets {
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelString(append(labels, "le", le)...), h.buckets[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelString(append(labels, "le", "+Inf")...), h.count)
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labelString(labels...), h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labelString(labels...), h.count)
+}
+
+// metricsTransport times upstream round trips and counts dial errors.
+type metricsTransport struct {
+	base                     http.RoundTripper
+	metrics                  *metrics
+	project, route, upstream string
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	t.metrics.observeUpstream(t.project, t.route, t.upstream, time.Since(start), err)
+	return resp, err
+}
+
+// isLoopbackAddr reports whether addr listens on a loopback interface only.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
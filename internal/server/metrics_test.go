@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	backend := namedBackend(t, "ok")
+	m := newMetrics(nil)
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"demo": {
+			Domains: []string{"demo.localhost"},
+			Routes: []*config.Route{
+				{Path: "/api", Upstream: backend.URL},
+				{Path: "/down", Upstream: closedUpstream(t)},
+			},
+		},
+	}}
+	routers, err := buildRouters(cfg, buildEnv{metrics: m})
+	if err != nil {
+		t.Fatalf("buildRouters returned error: %v", err)
+	}
+	s := &Server{routers: routers, metrics: m}
+	for _, path := range []string{"/api/a", "/api/b", "/down"} {
+		s.handleHTTPS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://demo.localhost"+path, nil))
+	}
+	for _, host := range []string{"a.example", "b.example", "c.localhost"} {
+		s.handleHTTPS(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "https://"+host+"/", nil))
+	}
+	m.observeReload(nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	for _, want := range []string{
+		`devlink_requests_total{project="demo",domain="demo.localhost",route="/api",code="2xx"} 2`,
+		`devlink_requests_total{project="demo",domain="demo.localhost",route="/down",code="5xx"} 1`,
+		`devlink_request_duration_seconds_count{project="demo",domain="demo.localhost",route="/api",code="2xx"} 2`,
+		`devlink_upstream_duration_seconds_bucket{project="demo",route="/api",upstream="` + backend.URL + `",le="+Inf"} 2`,
+		`devlink_upstream_dial_errors_total{project="demo",route="/down",upstream="`,
+		`devlink_requests_total{project="",domain="unmatched",route="",code="5xx"} 3`,
+		`devlink_config_reloads_total{result="success"} 1`,
+		"# TYPE devlink_websocket_connections gauge",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output is missing %s\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "example") {
+		t.Errorf("expected unknown hosts not to become label values\n%s", out)
+	}
+}
+
+func TestMetricsRequireLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:9090": true,
+		"localhost:9090": true,
+		"[::1]:9090":     true,
+		"0.0.0.0:9090":   false,
+		":9090":          false,
+	} {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
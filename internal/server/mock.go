@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+// maxMockBodyBytes caps the request body exposed to response templates.
+const maxMockBodyBytes = 1 << 20
+
+// mockHandler answers requests with canned responses and hands unmatched
+// requests to next.
+type mockHandler struct {
+	responses []*mockResponse
+	dir       string
+	prefix    string
+	strip     bool
+	next      http.Handler
+}
+
+type mockResponse struct {
+	method   string
+	pattern  []string
+	query    map[string]string
+	headers  map[string]string
+	status   int
+	respHdrs map[string]string
+	body     *template.Template
+	latency  time.Duration
+}
+
+// mockRequest is the data available to response templates.
+type mockRequest struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Headers http.Header
+	Params  map[string]string
+	Body    string
+}
+
+func newMockHandler(r *config.Route, baseDir string, strip bool, next http.Handler) (*mockHandler, error) {
+	h := &mockHandler{prefix: r.Path, strip: strip, next: next}
+	if r.Mock.Dir != "" {
+		h.dir = r.Mock.Dir
+		if !filepath.IsAbs(h.dir) {
+			h.dir = filepath.Join(baseDir, h.dir)
+		}
+	}
+	for i, resp := range r.Mock.Responses {
+		compiled, err := compileMockResponse(resp, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("mock response %d: %w", i+1, err)
+		}
+		h.responses = append(h.responses, compiled)
+	}
+	return h, nil
+}
+
+func compileMockResponse(resp *config.MockResponse, baseDir string) (*mockResponse, error) {
+	m := &mockResponse{
+		method:   strings.ToUpper(resp.Match.Method),
+		query:    resp.Match.Query,
+		headers:  resp.Match.Headers,
+		status:   resp.Status,
+		respHdrs: resp.Headers,
+		latency:  resp.Latency.Std(),
+	}
+	if m.status == 0 {
+		m.status = http.StatusOK
+	}
+	if resp.Match.Path != "" {
+		if !strings.HasPrefix(resp.Match.Path, "/") {
+			return nil, fmt.Errorf("match path must start with '/' (got %s)", resp.Match.Path)
+		}
+		m.pattern = splitPath(resp.Match.Path)
+	}
+	body := resp.Body
+	if resp.BodyFile != "" {
+		if body != "" {
+			return nil, fmt.Errorf("body and bodyFile are mutually exclusive")
+		}
+		name := resp.BodyFile
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(baseDir, name)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("read body file: %w", err)
+		}
+		body = string(data)
+		if _, ok := m.respHdrs["Content-Type"]; !ok {
+			if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+				m.respHdrs = withHeader(m.respHdrs, "Content-Type", ctype)
+			}
+		}
+	}
+	tmpl, err := template.New("body").Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse body template: %w", err)
+	}
+	m.body = tmpl
+	return m, nil
+}
+
+func withHeader(headers map[string]string, key, value string) map[string]string {
+	out := map[string]string{key: value}
+	for k, v := range headers {
+		out[k] = v
+	}
+	return out
+}
+
+func (h *mockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, resp := range h.responses {
+		if params, ok := resp.matches(r); ok {
+			h.serveResponse(w, r, resp, params)
+			return
+		}
+	}
+	if h.dir != "" && h.serveFixture(w, r) {
+		return
+	}
+	if h.next != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "no mock response for " + r.Method + " " + r.URL.Path})
+}
+
+func (m *mockResponse) matches(r *http.Request) (map[string]string, bool) {
+	if m.method != "" && m.method != r.Method {
+		return nil, false
+	}
+	for key, want := range m.query {
+		if r.URL.Query().Get(key) != want {
+			return nil, false
+		}
+	}
+	for key, want := range m.headers {
+		if r.Header.Get(key) != want {
+			return nil, false
+		}
+	}
+	params := map[string]string{}
+	if m.pattern == nil {
+		return params, true
+	}
+	segments := splitPath(r.URL.Path)
+	for i, part := range m.pattern {
+		if part == "**" && i == len(m.pattern)-1 {
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		switch {
+		case part == "*":
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			params[part[1:len(part)-1]] = segments[i]
+		case part != segments[i]:
+			return nil, false
+		}
+	}
+	if len(segments) != len(m.pattern) {
+		return nil, false
+	}
+	return params, true
+}
+
+func (h *mockHandler) serveResponse(w http.ResponseWriter, r *http.Request, resp *mockResponse, params map[string]string) {
+	if !sleepContext(r, resp.latency) {
+		return
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, maxMockBodyBytes))
+	var buf bytes.Buffer
+	err := resp.body.Execute(&buf, mockRequest{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+		Params:  params,
+		Body:    string(body),
+	})
+	if err != nil {
+		log.Printf("mock template for %s: %v", r.URL.Path, err)
+		http.Error(w, "mock template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for key, value := range resp.respHdrs {
+		w.Header().Set(key, value)
+	}
+	w.Header().Set("X-Devlink-Mock", "true")
+	w.WriteHeader(resp.status)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
+
+// serveFixture looks up a fixture file for the request below the fixture
+// directory: <path>.<METHOD>.json and <path>.<METHOD> for every method, and
+// additionally <path>.json, <path> and <path>/index.json for GET and HEAD.
+func (h *mockHandler) serveFixture(w http.ResponseWriter, r *http.Request) bool {
+	rel := r.URL.Path
+	if h.strip && h.prefix != "/" {
+		rel = strings.TrimPrefix(rel, strings.TrimSuffix(h.prefix, "/"))
+	}
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if rel == "" {
+		rel = "index"
+	}
+	base := filepath.Join(h.dir, filepath.FromSlash(rel))
+	candidates := []string{base + "." + r.Method + ".json", base + "." + r.Method}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		candidates = append(candidates, base+".json", base, filepath.Join(base, "index.json"))
+	}
+	for _, name := range candidates {
+		info, err := os.Stat(name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.Printf("mock fixture %s: %v", name, err)
+			continue
+		}
+		ext := filepath.Ext(name)
+		if strings.EqualFold(ext, "."+r.Method) {
+			ext = filepath.Ext(strings.TrimSuffix(name, ext))
+		}
+		if ctype := mime.TypeByExtension(ext); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("X-Devlink-Mock", "true")
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+		return true
+	}
+	return false
+}
+
+// sleepContext waits for d unless the request is cancelled first.
+func sleepContext(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return []string{}
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+func TestMockResponsesWithFallthrough(t *testing.T) {
+	real := namedBackend(t, "real")
+	rt := newTestRoute(t, &config.Route{
+		Path:     "/api",
+		Upstream: real.URL,
+		Mock: &config.Mock{Responses: []*config.MockResponse{
+			{
+				Match:   config.MockMatch{Method: "GET", Path: "/api/new-feature/{id}", Query: map[string]string{"view": "full"}},
+				Status:  http.StatusCreated,
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    `{"id":"{{.Params.id}}","agent":"{{.Headers.Get "User-Agent"}}"}`,
+				Latency: config.Duration(time.Millisecond),
+			},
+			{
+				Match:  config.MockMatch{Path: "/api/new-feature/**", Headers: map[string]string{"X-Role": "admin"}},
+				Status: http.StatusForbidden,
+			},
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/new-feature/42?view=full", nil)
+	req.Header.Set("User-Agent", "test")
+	rec, body := serveBody(t, rt, req)
+	if rec.Code != http.StatusCreated || body != `{"id":"42","agent":"test"}` {
+		t.Fatalf("unexpected mock response %d %q", rec.Code, body)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "https://demo.localhost/api/new-feature/42/items", nil)
+	req.Header.Set("X-Role", "admin")
+	if rec, _ := serveBody(t, rt, req); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected wildcard match, got %d", rec.Code)
+	}
+
+	if _, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/users", nil)); body != "real" {
+		t.Fatalf("expected unmatched request to reach upstream, got %q", body)
+	}
+}
+
+func TestMockFixtureDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"fixtures/users/42.json":   `{"id":42}`,
+		"fixtures/users.POST.json": `{"created":true}`,
+	})
+	rt, err := buildRuntimeRoute("demo", &config.Route{
+		Path: "/api",
+		Mock: &config.Mock{Dir: "fixtures"},
+	}, buildEnv{baseDir: dir})
+	if err != nil {
+		t.Fatalf("buildRuntimeRoute returned error: %v", err)
+	}
+
+	rec, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/users/42", nil))
+	if body != `{"id":42}` || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected fixture response %q %q", rec.Header().Get("Content-Type"), body)
+	}
+	if _, body := serveBody(t, rt, httptest.NewRequest(http.MethodPost, "https://demo.localhost/api/users", nil)); body != `{"created":true}` {
+		t.Fatalf("unexpected POST fixture %q", body)
+	}
+	if rec, _ := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/missing", nil)); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without upstream, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"local-ssl/internal/har"
+)
+
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactedHeaders are masked in recordings unless overridden.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// RecordOptions enable recording of upstream traffic into a HAR file.
+type RecordOptions struct {
+	Path string
+	// Projects limits recording to these projects; empty records all.
+	Projects     []string
+	MaxBodyBytes int64
+	// RedactHeaders are masked in the archive; nil selects
+	// DefaultRedactedHeaders.
+	RedactHeaders []string
+}
+
+// harRecorder collects exchanges and periodically appends them to the
+// archive on disk.
+type harRecorder struct {
+	path     string
+	projects map[string]bool
+	redact   map[string]bool
+
+	mu sync.Mutex
+	// pending holds the entries not written yet.
+	pending []*har.Entry
+	// writer is opened by the first flush; flushMu guards it.
+	flushMu sync.Mutex
+	writer  *har.Writer
+}
+
+func newHARRecorder(opts *RecordOptions) *harRecorder {
+	redact := opts.RedactHeaders
+	if redact == nil {
+		redact = DefaultRedactedHeaders
+	}
+	r := &harRecorder{
+		path:     opts.Path,
+		projects: map[string]bool{},
+		redact:   map[string]bool{},
+	}
+	for _, p := range opts.Projects {
+		r.projects[p] = true
+	}
+	for _, h := range redact {
+		r.redact[http.CanonicalHeaderKey(h)] = true
+	}
+	return r
+}
+
+func (r *harRecorder) wants(project string) bool {
+	return len(r.projects) == 0 || r.projects[project]
+}
+
+func (r *harRecorder) observe(ex *exchange) {
+	entry := r.entry(ex)
+	r.mu.Lock()
+	r.pending = append(r.pending, entry)
+	r.mu.Unlock()
+}
+
+// run flushes the archive every interval until stop is closed, then flushes
+// a final time and closes it.
+func (r *harRecorder) run(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			r.flush()
+			r.close()
+			return
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+// flush appends the pending entries to the archive, creating it on the
+// first call so that an idle recording still leaves an empty archive.
+func (r *harRecorder) flush() {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	if r.writer == nil {
+		w, err := har.Create(r.path)
+		if err != nil {
+			log.Printf("record: %v", err)
+			return
+		}
+		r.writer = w
+	}
+	r.mu.Lock()
+	entries := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if err := r.writer.Append(entries...); err != nil {
+		log.Printf("record: %v", err)
+	}
+}
+
+func (r *harRecorder) close() {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	if r.writer != nil {
+		r.writer.Close()
+		r.writer = nil
+	}
+}
+
+func (r *harRecorder) entry(ex *exchange) *har.Entry {
+	e := &har.Entry{
+		StartedDateTime: ex.Started.UTC().Format(time.RFC3339Nano),
+		Time:            millis(ex.Timings.Total),
+		Project:         ex.Project,
+		Route:           ex.Route,
+		Request: har.Request{
+			Method:      ex.Method,
+			URL:         ex.URL,
+			HTTPVersion: ex.Proto,
+			Headers:     r.headers(ex.RequestHeader),
+			QueryString: []har.NameValue{},
+			Cookies:     []har.NameValue{},
+			HeadersSize: -1,
+		},
+		Response: har.Response{
+			Status:      ex.Status,
+			StatusText:  http.StatusText(ex.Status),
+			HTTPVersion: ex.ResponseProto,
+			Headers:     r.headers(ex.ResponseHeader),
+			Cookies:     []har.NameValue{},
+			HeadersSize: -1,
+			RedirectURL: ex.ResponseHeader.Get("Location"),
+		},
+		Timings: har.Timings{
+			Blocked: -1,
+			DNS:     phase(ex.Timings.DNS),
+			Connect: phase(ex.Timings.Connect),
+			SSL:     phase(ex.Timings.TLS),
+			Send:    0,
+			Wait:    millis(ex.Timings.TTFB - ex.Timings.DNS - ex.Timings.Connect),
+			Receive: millis(ex.Timings.Total - ex.Timings.TTFB),
+		},
+	}
+	if ex.Err != nil {
+		e.Comment = "upstream error: " + ex.Err.Error()
+	}
+	if u, err := url.Parse(ex.URL); err == nil {
+		for key, values := range u.Query() {
+			for _, v := range values {
+				e.Request.QueryString = append(e.Request.QueryString, har.NameValue{Name: key, Value: v})
+			}
+		}
+		sort.Slice(e.Request.QueryString, func(i, j int) bool {
+			return e.Request.QueryString[i].Name < e.Request.QueryString[j].Name
+		})
+	}
+	if ex.RequestBody != nil {
+		text, encoding := bodyText(ex.RequestBody.Bytes())
+		e.Request.BodySize = ex.RequestBody.size
+		e.Request.PostData = &har.PostData{
+			MimeType: ex.RequestHeader.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+	}
+	if ex.ResponseBody != nil {
+		text, encoding := bodyText(ex.ResponseBody.Bytes())
+		e.Response.BodySize = ex.ResponseBody.size
+		e.Response.Content = har.Content{
+			Size:     ex.ResponseBody.size,
+			MimeType: ex.ResponseHeader.Get("Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		}
+		if ex.ResponseBody.truncated {
+			e.Response.Content.Comment = "truncated"
+		}
+	}
+	return e
+}
+
+func (r *harRecorder) headers(h http.Header) []har.NameValue {
+	out := []har.NameValue{}
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, v := range h[key] {
+			if r.redact[http.CanonicalHeaderKey(key)] {
+				v = redactedValue
+			}
+			out = append(out, har.NameValue{Name: key, Value: v})
+		}
+	}
+	return out
+}
+
+// bodyText returns the body as text, base64 encoding anything that is not
+// valid UTF-8 such as compressed or binary payloads.
+func bodyText(body []byte) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func millis(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+func phase(d time.Duration) float64 {
+	if d == 0 {
+		return -1
+	}
+	return millis(d)
+}
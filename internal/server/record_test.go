@@ -0,0 +1,71 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/config"
+	"local-ssl/internal/har"
+)
+
+func TestRecorderCapturesExchanges(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, `{"echo":"`+string(body)+`","padding":"0123456789"}`)
+	}))
+	defer backend.Close()
+
+	path := filepath.Join(t.TempDir(), "out.har")
+	recorder := newHARRecorder(&RecordOptions{Path: path, Projects: []string{"demo"}})
+	observer := newTrafficObserver(16)
+	observer.add(recorder)
+
+	rt, err := buildRuntimeRoute("demo", &config.Route{Path: "/api", Upstream: backend.URL}, buildEnv{observer: observer})
+	if err != nil {
+		t.Fatalf("buildRuntimeRoute returned error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://demo.localhost/api/items?page=2", strings.NewReader("hello"))
+	req.Header.Set("Authorization", "Bearer token")
+	serveBody(t, rt, req)
+	recorder.flush()
+	defer recorder.close()
+	if len(recorder.pending) != 0 {
+		t.Fatal("expected flushed entries to be released")
+	}
+
+	archive, err := har.Load(path)
+	if err != nil {
+		t.Fatalf("load har: %v", err)
+	}
+	if len(archive.Log.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(archive.Log.Entries))
+	}
+	e := archive.Log.Entries[0]
+	if e.Project != "demo" || e.Route != "/api" || !strings.HasSuffix(e.Request.URL, "/items?page=2") {
+		t.Fatalf("unexpected entry metadata %+v", e)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != "hello" {
+		t.Fatalf("request body not captured: %+v", e.Request.PostData)
+	}
+	for _, h := range append(e.Request.Headers, e.Response.Headers...) {
+		if (h.Name == "Authorization" || h.Name == "Set-Cookie") && h.Value != redactedValue {
+			t.Fatalf("header %s was not redacted: %q", h.Name, h.Value)
+		}
+	}
+	if e.Response.Status != http.StatusOK || len(e.Response.Content.Text) != 16 || e.Response.Content.Comment != "truncated" {
+		t.Fatalf("unexpected response content %+v", e.Response.Content)
+	}
+}
+
+func TestRecorderSkipsOtherProjects(t *testing.T) {
+	recorder := newHARRecorder(&RecordOptions{Projects: []string{"demo"}})
+	if recorder.wants("other") || !recorder.wants("demo") {
+		t.Fatal("recorder project filter is wrong")
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// requestInfo accumulates what the gateway did with a request. It travels in
+// the request context and is filled in by the router and the upstream proxy.
+type requestInfo struct {
+	Start time.Time
+	Host  string
+	// Domain is the configured domain the request was routed by.
+	Domain        string
+	Method        string
+	RequestURI    string
+	OriginalPath  string
+	Project       string
+	Route         string
+	RewrittenPath string
+	Upstream      string
+	Fallback      bool
+	Timings       exchangeTimings
+	// Span is the server span of the request when tracing is enabled.
+	Span *span
+}
+
+type requestInfoKey struct{}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// timingTransport records connection phase timings of upstream requests in
+// their requestInfo.
+type timingTransport struct {
+	base http.RoundTripper
+}
+
+func (t timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	info := requestInfoFrom(req.Context())
+	if info == nil {
+		return t.base.RoundTrip(req)
+	}
+	trace := timingTrace(time.Now(), &info.Timings)
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// statusWriter records the status and size of a response and optionally
+// keeps a prefix of its body.
+type statusWriter struct {
+	http.ResponseWriter
+	status    int
+	bytes     int64
+	limit     int64
+	body      bytes.Buffer
+	truncated bool
+}
+
+func newStatusWriter(w http.ResponseWriter, captureLimit int64) *statusWriter {
+	return &statusWriter{ResponseWriter: w, limit: captureLimit}
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	if room := w.limit - int64(w.body.Len()); room > 0 {
+		if int64(n) > room {
+			w.body.Write(p[:room])
+			w.truncated = true
+		} else {
+			w.body.Write(p[:n])
+		}
+	} else if w.limit > 0 && n > 0 {
+		w.truncated = true
+	}
+	return n, err
+}
+
+// Flush supports streaming responses such as server-sent events.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController, which
+// the reverse proxy uses to hijack WebSocket connections.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the response status, treating an untouched response as
+// 200 like net/http does.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
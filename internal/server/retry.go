@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+const (
+	defaultRetryTimeout  = 15 * time.Second
+	defaultRetryInterval = 250 * time.Millisecond
+	defaultRetryMaxBody  = 1 << 20
+)
+
+// retryTransport replays idempotent requests while the upstream refuses
+// connections. Only refused dials are retried, so a request is never sent to
+// the upstream twice, and an unknown host or a timeout fails right away.
+type retryTransport struct {
+	base     http.RoundTripper
+	timeout  time.Duration
+	interval time.Duration
+	maxBody  int64
+}
+
+func newRetryTransport(base http.RoundTripper, policy *config.RetryPolicy) http.RoundTripper {
+	if policy == nil {
+		return base
+	}
+	t := &retryTransport{
+		base:     base,
+		timeout:  policy.Timeout.Std(),
+		interval: policy.Interval.Std(),
+		maxBody:  policy.MaxBodyBytes,
+	}
+	if t.timeout <= 0 {
+		t.timeout = defaultRetryTimeout
+	}
+	if t.interval <= 0 {
+		t.interval = defaultRetryInterval
+	}
+	if t.maxBody <= 0 {
+		t.maxBody = defaultRetryMaxBody
+	}
+	return t
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req.Method) {
+		return t.base.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		buffered, err := io.ReadAll(io.LimitReader(req.Body, t.maxBody+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(buffered)) > t.maxBody {
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(buffered), req.Body), req.Body}
+			return t.base.RoundTrip(req)
+		}
+		req.Body.Close()
+		body = buffered
+	}
+
+	deadline := time.Now().Add(t.timeout)
+	for {
+		attempt := req
+		if body != nil {
+			attempt = req.Clone(req.Context())
+			attempt.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.base.RoundTrip(attempt)
+		if err == nil || !isConnRefused(err) || time.Now().Add(t.interval).After(deadline) {
+			return resp, err
+		}
+		timer := time.NewTimer(t.interval)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isConnRefused reports whether dialing failed because nothing listens on
+// the upstream address: a refused TCP connection or a missing unix socket.
+func isConnRefused(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		return false
+	}
+	for _, target := range refusedErrors {
+		if errors.Is(opErr.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDialError reports whether the upstream could not be reached at all.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+// delayedBackend starts an echo server on addr after delay.
+func delayedBackend(t *testing.T, addr string, delay time.Duration) {
+	t.Helper()
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+string(body))
+	})}
+	t.Cleanup(func() { srv.Close() })
+	go func() {
+		time.Sleep(delay)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("listen: %v", err)
+			return
+		}
+		srv.Serve(ln)
+	}()
+}
+
+func TestRetryHoldsRequestsUntilUpstreamStarts(t *testing.T) {
+	upstream := closedUpstream(t)
+	delayedBackend(t, strings.TrimPrefix(upstream, "http://"), 150*time.Millisecond)
+	rt := newTestRoute(t, &config.Route{
+		Path:     "/",
+		Upstream: upstream,
+		Retry:    &config.RetryPolicy{Timeout: config.Duration(5 * time.Second), Interval: config.Duration(20 * time.Millisecond)},
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "https://demo.localhost/", strings.NewReader("payload"))
+	rec, body := serveBody(t, rt, req)
+	if rec.Code != http.StatusOK || body != "PUT payload" {
+		t.Fatalf("expected replayed request, got %d %q", rec.Code, body)
+	}
+}
+
+func TestRetrySkipsNonIdempotentRequests(t *testing.T) {
+	upstream := closedUpstream(t)
+	delayedBackend(t, strings.TrimPrefix(upstream, "http://"), 150*time.Millisecond)
+	rt := newTestRoute(t, &config.Route{
+		Path:     "/",
+		Upstream: upstream,
+		Retry:    &config.RetryPolicy{Timeout: config.Duration(5 * time.Second)},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "https://demo.localhost/", strings.NewReader("payload"))
+	if rec, _ := serveBody(t, rt, req); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected POST to fail immediately with 502, got %d", rec.Code)
+	}
+}
+
+func TestRetrySkipsOversizedBodies(t *testing.T) {
+	rt := newTestRoute(t, &config.Route{
+		Path:     "/",
+		Upstream: closedUpstream(t),
+		Retry:    &config.RetryPolicy{Timeout: config.Duration(5 * time.Second), MaxBodyBytes: 4},
+	})
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodPut, "https://demo.localhost/", strings.NewReader("payload"))
+	if rec, _ := serveBody(t, rt, req); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", rec.Code)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("oversized request was held for retries")
+	}
+}
+
+func TestRetryOnlyRetriesRefusedConnections(t *testing.T) {
+	dial := func(err error) error { return &net.OpError{Op: "dial", Net: "tcp", Err: err} }
+	for name, tc := range map[string]struct {
+		err  error
+		want bool
+	}{
+		"refused":        {dial(&os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}), true},
+		"missing socket": {dial(&os.SyscallError{Syscall: "connect", Err: syscall.ENOENT}), true},
+		"unknown host":   {dial(&net.DNSError{Err: "no such host", Name: "api.invalid", IsNotFound: true}), false},
+		"timeout":        {dial(os.ErrDeadlineExceeded), false},
+		"unreachable":    {dial(&os.SyscallError{Syscall: "connect", Err: syscall.EHOSTUNREACH}), false},
+		"read":           {&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, false},
+	} {
+		if got := isConnRefused(tc.err); got != tc.want {
+			t.Errorf("%s: expected %t, got %t", name, tc.want, got)
+		}
+	}
+
+	calls := 0
+	transport := newRetryTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		return nil, dial(&net.DNSError{Err: "no such host", Name: "api.invalid", IsNotFound: true})
+	}), &config.RetryPolicy{Timeout: config.Duration(5 * time.Second)})
+	start := time.Now()
+	if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://api.invalid/", nil)); err == nil {
+		t.Fatal("expected the DNS error")
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Fatalf("expected an unknown host to fail at once, got %d call(s) in %s", calls, time.Since(start))
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package server
+
+import "syscall"
+
+// refusedErrors are the dial errors of an upstream that is not listening.
+var refusedErrors = []error{syscall.ECONNREFUSED, syscall.ENOENT}
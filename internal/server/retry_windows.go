@@ -0,0 +1,12 @@
+//go:build windows
+
+package server
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// refusedErrors are the dial errors of an upstream that is not listening.
+var refusedErrors = []error{windows.WSAECONNREFUSED, syscall.ERROR_FILE_NOT_FOUND, syscall.ENOENT}
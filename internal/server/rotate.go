@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// rotatingFile is an append-only log file that is renamed to name.1,
+// name.2, … once it grows past maxSize. With no backups the file is
+// removed instead.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		// A failed rotation keeps appending to the current file and is
+		// retried by the next write.
+		if err := rf.rotate(); err != nil && rf.f == nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups and starts a new file. The file is closed
+// first because Windows cannot rename open files, and is reopened when the
+// rename fails so the log is not lost.
+func (rf *rotatingFile) rotate() error {
+	err := rf.f.Close()
+	rf.f = nil
+	if err == nil {
+		err = rf.shift()
+	}
+	if openErr := rf.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// shift moves the closed file to the first backup, or removes it when no
+// backups are kept.
+func (rf *rotatingFile) shift() error {
+	if rf.maxBackups <= 0 {
+		return os.Remove(rf.path)
+	}
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(backupName(rf.path, i), backupName(rf.path, i+1))
+	}
+	return os.Rename(rf.path, backupName(rf.path, 1))
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
+
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
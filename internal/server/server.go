@@ -2,22 +2,27 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
+	"local-ssl/internal/admin"
 	"local-ssl/internal/certs"
 	"local-ssl/internal/config"
+	"local-ssl/internal/har"
+	"local-ssl/internal/ports"
 )
 
 // Options configure the behaviour of the reverse proxy server.
@@ -26,15 +31,51 @@ type Options struct {
 	StateDir   string
 	HTTPPort   int
 	HTTPSPort  int
+	// Readiness, when set, gates traffic to routes whose upstream is still
+	// starting.
+	Readiness ReadinessFunc
+	// Record, when set, captures upstream traffic into a HAR file.
+	Record *RecordOptions
+	// DisableInspector turns off the traffic inspector served at
+	// InspectorHost.
+	DisableInspector bool
+	// MetricsAddr, when set, serves Prometheus metrics at /metrics on this
+	// loopback address.
+	MetricsAddr string
 }
 
+// ReadinessFunc reports whether the upstream of a project route is ready to
+// receive traffic.
+type ReadinessFunc func(project, route string) bool
+
 // Server orchestrates the TLS proxy for .localhost domains.
 type Server struct {
 	opts      Options
 	watcher   *fsnotify.Watcher
 	mu        sync.RWMutex
 	routers   map[string]*domainRouter
+	stopCheck context.CancelFunc
 	tlsConfig *tls.Config
+	observer  *trafficObserver
+	recorder  *harRecorder
+	inspector *inspector
+	accessLog *accessLogger
+	metrics   *metrics
+	tracer    *tracer
+	certs     *certs.Manager
+	control   *controlState
+	started   time.Time
+
+	// reloadMu serializes reloads from the watcher and the control API.
+	reloadMu   sync.Mutex
+	lastReload admin.Reload
+	// configHash is the digest of the configuration files and the port
+	// assignments of the routing table last applied, and snapshot what the
+	// files last read by reload resolved to.
+	configHash [sha256.Size]byte
+	snapshot   *config.Snapshot
+	// watched holds the directories added to the watcher; reloadMu guards it.
+	watched map[string]bool
 }
 
 // New creates a new server and loads initial configuration.
@@ -48,6 +89,9 @@ func New(opts Options) (*Server, error) {
 	if opts.HTTPSPort == 0 {
 		opts.HTTPSPort = 443
 	}
+	if opts.MetricsAddr != "" && !isLoopbackAddr(opts.MetricsAddr) {
+		return nil, fmt.Errorf("metrics address %s is not a loopback address", opts.MetricsAddr)
+	}
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -70,21 +114,35 @@ func New(opts Options) (*Server, error) {
 		opts:    opts,
 		watcher: watcher,
 		routers: map[string]*domainRouter{},
+		certs:   mgr,
+		control: newControlState(),
 		tlsConfig: &tls.Config{
 			Certificates: []tls.Certificate{*tlsCert},
 			MinVersion:   tls.VersionTLS12,
 		},
 	}
 
+	if opts.MetricsAddr != "" {
+		s.metrics = newMetrics(mgr)
+	}
+
+	if opts.Record != nil {
+		s.observer = newTrafficObserver(opts.Record.MaxBodyBytes)
+		s.recorder = newHARRecorder(opts.Record)
+		s.observer.add(s.recorder)
+	}
+
+	if !opts.DisableInspector {
+		s.inspector = newInspector(inspectorURL(opts.HTTPSPort), func(r *http.Request) {
+			s.handleHTTPS(&discardWriter{}, r)
+		})
+	}
+
 	if err := s.reload(); err != nil {
 		watcher.Close()
 		return nil, err
 	}
 
-	if err := watcher.Add(opts.ConfigPath); err != nil {
-		log.Printf("watch: %v", err)
-	}
-
 	return s, nil
 }
 
@@ -107,7 +165,14 @@ func (s *Server) Run(ctx context.Context) error {
 		IdleTimeout:  2 * time.Minute,
 	}
 
-	errCh := make(chan error, 2)
+	s.started = time.Now()
+	controlListener, err := s.listenControl()
+	if err != nil {
+		return err
+	}
+	controlServer := &http.Server{Handler: s.controlHandler()}
+
+	errCh := make(chan error, 4)
 
 	go func() {
 		log.Printf("HTTP redirect server listening on %s", httpServer.Addr)
@@ -123,8 +188,47 @@ func (s *Server) Run(ctx context.Context) error {
 		}
 	}()
 
+	var metricsServer *http.Server
+	if s.metrics != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics)
+		metricsServer = &http.Server{
+			Addr:        s.opts.MetricsAddr,
+			Handler:     mux,
+			ReadTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Printf("metrics available at http://%s/metrics", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	}
+
+	go func() {
+		if err := controlServer.Serve(controlListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("control server: %w", err)
+		}
+	}()
+
 	go s.watchLoop(ctx)
 
+	if s.inspector != nil {
+		log.Printf("traffic inspector available at %s", inspectorURL(s.opts.HTTPSPort))
+	}
+
+	recordDone := make(chan struct{})
+	stopRecord := make(chan struct{})
+	if s.recorder != nil {
+		log.Printf("recording traffic to %s", s.recorder.path)
+		go func() {
+			defer close(recordDone)
+			s.recorder.run(stopRecord, 2*time.Second)
+		}()
+	} else {
+		close(recordDone)
+	}
+
 	select {
 	case <-ctx.Done():
 	case err := <-errCh:
@@ -137,32 +241,31 @@ func (s *Server) Run(ctx context.Context) error {
 	defer cancel()
 	_ = httpServer.Shutdown(shutdownCtx)
 	_ = httpsServer.Shutdown(shutdownCtx)
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(shutdownCtx)
+	}
+	_ = controlServer.Shutdown(shutdownCtx)
+	if s.inspector != nil {
+		s.inspector.close()
+	}
 
-	return nil
-}
-
-func (s *Server) watchLoop(ctx context.Context) {
-	defer s.watcher.Close()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case event, ok := <-s.watcher.Events:
-			if !ok {
-				return
-			}
-			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
-				if err := s.reload(); err != nil {
-					log.Printf("reload error: %v", err)
-				}
-			}
-		case err, ok := <-s.watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Printf("watch error: %v", err)
-		}
+	s.mu.Lock()
+	if s.stopCheck != nil {
+		s.stopCheck()
 	}
+	s.mu.Unlock()
+
+	close(stopRecord)
+	<-recordDone
+
+	s.mu.Lock()
+	accessLog, tracer := s.accessLog, s.tracer
+	s.accessLog, s.tracer = nil, nil
+	s.mu.Unlock()
+	accessLog.Close()
+	tracer.Close()
+
+	return nil
 }
 
 func (s *Server) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
@@ -177,13 +280,78 @@ func (s *Server) handleHTTPS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if host == InspectorHost && s.inspector != nil {
+		s.inspector.ServeHTTP(w, r)
+		return
+	}
+
+	info := &requestInfo{
+		Start:        time.Now(),
+		Host:         host,
+		Method:       r.Method,
+		RequestURI:   r.URL.RequestURI(),
+		OriginalPath: r.URL.Path,
+	}
+	s.mu.RLock()
+	tracer := s.tracer
+	s.mu.RUnlock()
+	if tracer != nil {
+		parent, _ := parseTraceparent(r.Header.Get("traceparent"))
+		info.Span = tracer.start(spanKindServer, r.Method, parent)
+	}
+	r = r.WithContext(withRequestInfo(r.Context(), info))
+	sw := newStatusWriter(w, 0)
+	var reqHeader http.Header
+	var reqBody *capturedBody
+	if s.inspector != nil {
+		sw.limit = inspectorMaxBody
+		reqHeader = r.Header.Clone()
+		if r.Body != nil && r.Body != http.NoBody {
+			reqBody = newCapturedBody(r.Body, inspectorMaxBody, nil)
+			r.Body = reqBody
+		}
+	}
+	defer s.finishRequest(info, r, reqHeader, reqBody, sw)
+
 	router := s.lookupRouter(host)
 	if router == nil {
-		http.Error(w, "unknown domain", http.StatusBadGateway)
+		http.Error(sw, "unknown domain", http.StatusBadGateway)
 		return
 	}
+	// Routers are keyed by their configured domains.
+	info.Domain = host
 
-	router.ServeHTTP(w, r)
+	router.ServeHTTP(sw, r)
+}
+
+// finishRequest logs a handled request and hands it to the inspector.
+func (s *Server) finishRequest(info *requestInfo, r *http.Request, reqHeader http.Header, reqBody *capturedBody, sw *statusWriter) {
+	s.mu.RLock()
+	accessLog := s.accessLog
+	s.mu.RUnlock()
+	if accessLog != nil {
+		accessLog.log(info, r, sw)
+	}
+	s.metrics.observeRequest(info, sw.Status(), time.Since(info.Start))
+	if sp := info.Span; sp != nil {
+		if info.Route != "" {
+			sp.name = info.Method + " " + info.Route
+			sp.set("http.route", info.Route)
+		}
+		sp.set("http.request.method", info.Method)
+		sp.set("server.address", info.Host)
+		sp.set("url.path", info.OriginalPath)
+		sp.set("http.response.status_code", sw.Status())
+		sp.set("devlink.project", info.Project)
+		sp.set("devlink.route", info.Route)
+		if sw.Status() >= 500 {
+			sp.fail(http.StatusText(sw.Status()))
+		}
+		sp.finish()
+	}
+	if s.inspector != nil {
+		s.inspector.record(info, r, reqHeader, reqBody, sw)
+	}
 }
 
 func (s *Server) lookupRouter(host string) *domainRouter {
@@ -195,29 +363,138 @@ func (s *Server) lookupRouter(host string) *domainRouter {
 	return nil
 }
 
-func (s *Server) reload() error {
-	cfg, err := config.Load(s.opts.ConfigPath)
+func (s *Server) reload() (err error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	defer func() {
+		s.metrics.observeReload(err)
+		s.recordReload(err)
+	}()
+	snap, err := config.Read(s.opts.ConfigPath)
+	s.mu.Lock()
+	s.snapshot = snap
+	s.mu.Unlock()
+	s.watch(snap)
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(s.opts.ConfigPath, snap.Config); err != nil {
+		return err
+	}
+	cfg, err := ports.Apply(snap.Config, ports.Open(s.opts.StateDir))
+	if err != nil {
+		return err
+	}
+	baseDir := filepath.Dir(s.opts.ConfigPath)
+
+	s.mu.RLock()
+	prevLog, prevTracer := s.accessLog, s.tracer
+	s.mu.RUnlock()
+	tracer, err := newTracer(cfg.Tracing, baseDir, prevTracer)
+	if err != nil {
+		return err
+	}
+	accessLog, err := newAccessLogger(cfg.Logging, baseDir, s.opts.StateDir, prevLog)
+	// Release what this reload opened if it fails.
+	defer func() {
+		if err != nil {
+			if tracer != prevTracer {
+				tracer.Close()
+			}
+			if accessLog != prevLog {
+				accessLog.Close()
+			}
+		}
+	}()
 	if err != nil {
 		return err
 	}
-	routers, err := buildRouters(cfg)
+	routers, err := buildRouters(cfg, buildEnv{
+		ready:    s.opts.Readiness,
+		baseDir:  baseDir,
+		observer: s.observer,
+		metrics:  s.metrics,
+		tracer:   tracer,
+		control:  s.control,
+	})
 	if err != nil {
 		return err
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	startHealthChecks(ctx, routers)
 	s.mu.Lock()
+	// Recorded only once applied, so a reload that failed for a transient
+	// reason is retried on the next event even if the files are unchanged.
+	s.configHash = s.digest(snap)
 	s.routers = routers
+	s.accessLog = accessLog
+	s.tracer = tracer
+	stop := s.stopCheck
+	s.stopCheck = cancel
 	s.mu.Unlock()
-	log.Printf("configuration reloaded: %d project(s)", len(cfg.Projects))
+	if stop != nil {
+		stop()
+	}
+	if prevLog != accessLog {
+		prevLog.Close()
+	}
+	if prevTracer != tracer {
+		prevTracer.Close()
+	}
+	log.Printf("configuration reloaded: %d project(s) from %d file(s)", len(cfg.Projects), len(snap.Files))
 	return nil
 }
 
-func buildRouters(cfg *config.Config) (map[string]*domainRouter, error) {
+// watch adds the directories of the configuration and its included project
+// files to the watcher. Directories are watched because editors that save
+// by renaming a temporary file over a file replace the inode a file watch
+// would follow.
+func (s *Server) watch(snap *config.Snapshot) {
+	if s.watcher == nil {
+		return
+	}
+	if s.watched == nil {
+		s.watched = map[string]bool{}
+	}
+	// Ports allocated by devlink up for auto-port routes change upstreams.
+	for _, dir := range append(snap.WatchDirs(), s.opts.StateDir) {
+		if s.watched[dir] {
+			continue
+		}
+		if err := s.watcher.Add(dir); err != nil {
+			log.Printf("watch: %v", err)
+			continue
+		}
+		s.watched[dir] = true
+	}
+}
+
+// buildEnv carries the server-wide settings routes are built with.
+type buildEnv struct {
+	ready ReadinessFunc
+	// baseDir resolves relative paths such as static roots. buildRouters
+	// replaces it with the directory of each project's source file.
+	baseDir string
+	// observer, when set, captures upstream exchanges.
+	observer *trafficObserver
+	// metrics, when set, collects upstream latencies and errors.
+	metrics *metrics
+	// tracer, when set, wraps upstream calls in client spans.
+	tracer *tracer
+	// control holds drained projects and disabled routes.
+	control *controlState
+}
+
+func buildRouters(cfg *config.Config, env buildEnv) (map[string]*domainRouter, error) {
 	routers := map[string]*domainRouter{}
 	for name, project := range cfg.Projects {
 		if len(project.Domains) == 0 {
 			return nil, fmt.Errorf("project %s has no domains", name)
 		}
-		dr, err := newDomainRouter(project)
+		projectEnv := env
+		projectEnv.baseDir = project.Dir(env.baseDir)
+		dr, err := newDomainRouter(name, project, projectEnv)
 		if err != nil {
 			return nil, fmt.Errorf("project %s: %w", name, err)
 		}
@@ -226,6 +503,9 @@ func buildRouters(cfg *config.Config) (map[string]*domainRouter, error) {
 			if !strings.HasSuffix(normalized, ".localhost") {
 				return nil, fmt.Errorf("project %s: domain %s is not a .localhost domain", name, domain)
 			}
+			if normalized == InspectorHost {
+				return nil, fmt.Errorf("project %s: domain %s is reserved for the traffic inspector", name, domain)
+			}
 			routers[normalized] = dr
 		}
 	}
@@ -234,20 +514,27 @@ func buildRouters(cfg *config.Config) (map[string]*domainRouter, error) {
 
 // domainRouter handles routing for a single domain.
 type domainRouter struct {
+	project string
+	// source is the file the project was defined in.
+	source   string
 	routes   []*runtimeRoute
 	fallback *runtimeRoute
+	control  *controlState
 }
 
-func newDomainRouter(project *config.Project) (*domainRouter, error) {
+func newDomainRouter(name string, project *config.Project, env buildEnv) (*domainRouter, error) {
 	if len(project.Routes) == 0 {
 		return nil, errors.New("project has no routes")
 	}
-	dr := &domainRouter{}
+	dr := &domainRouter{project: name, source: project.Source, control: env.control}
 	for _, r := range project.Routes {
-		runtime, err := buildRuntimeRoute(r)
+		runtime, err := buildRuntimeRoute(name, r, env)
 		if err != nil {
 			return nil, err
 		}
+		if runtime.headers, err = newHeaderRules(project.Headers, r.Headers); err != nil {
+			return nil, fmt.Errorf("route %s: %w", r.Path, err)
+		}
 		if r.Path == "/" && r.SpaFallback {
 			dr.fallback = runtime
 		}
@@ -266,9 +553,13 @@ func newDomainRouter(project *config.Project) (*domainRouter, error) {
 
 func (dr *domainRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	originalPath := r.URL.Path
+	if originalPath == upstreamProbePath {
+		dr.serveUpstreamProbe(w, r)
+		return
+	}
 	route := dr.match(originalPath)
 	fallbackTriggered := false
-	if route == nil && dr.fallback != nil && acceptsHTML(r) {
+	if route == nil && dr.fallback != nil && dr.enabled(dr.fallback) && acceptsHTML(r) {
 		fallbackTriggered = true
 		route = dr.fallback
 		r.Header.Set("X-Devlink-Original-Path", originalPath)
@@ -279,55 +570,218 @@ func (dr *domainRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no matching route", http.StatusBadGateway)
 		return
 	}
+	if dr.control.isDrained(dr.project) {
+		writeUpstreamError(w, r, http.StatusServiceUnavailable, upstreamError{
+			Error:    "project draining",
+			Project:  dr.project,
+			Route:    route.path,
+			Upstream: strings.Join(route.upstreams(), ", "),
+			Detail:   "traffic to this project was drained through the control API",
+		})
+		return
+	}
 	route.serveHTTP(w, r, fallbackTriggered)
 }
 
 func (dr *domainRouter) match(path string) *runtimeRoute {
 	for _, route := range dr.routes {
-		if route.matches(path) {
+		if route.matches(path) && dr.enabled(route) {
 			return route
 		}
 	}
 	return nil
 }
 
+func (dr *domainRouter) enabled(route *runtimeRoute) bool {
+	return dr.control.routeEnabled(dr.project, route.path)
+}
+
 // runtimeRoute is an executable route entry.
 type runtimeRoute struct {
-	path        string
+	project string
+	path    string
+	// kind is proxy, static, mock or replay.
+	kind        string
 	stripPrefix bool
 	spaFallback bool
-	proxy       *httputil.ReverseProxy
+	websocket   bool
+	// retryTimeout and healthTimeout are reported in the routing table.
+	retryTimeout  time.Duration
+	healthTimeout time.Duration
+	// headers holds the header rules of the project and route, or nil.
+	headers *headerRules
+	// handler serves routes that are not proxied, such as static roots.
+	handler  http.Handler
+	balancer *balancer
+	health   *healthChecker
+	ready    ReadinessFunc
+	metrics  *metrics
 }
 
-func buildRuntimeRoute(r *config.Route) (*runtimeRoute, error) {
+func buildRuntimeRoute(project string, r *config.Route, env buildEnv) (*runtimeRoute, error) {
 	if r.Path == "" || !strings.HasPrefix(r.Path, "/") {
 		return nil, fmt.Errorf("invalid path %q", r.Path)
 	}
-	upstreamURL, err := url.Parse(r.Upstream)
-	if err != nil {
-		return nil, fmt.Errorf("invalid upstream for path %s: %w", r.Path, err)
+
+	strip := true
+	if r.StripPathPrefix != nil {
+		strip = *r.StripPathPrefix
 	}
 
-	switch upstreamURL.Scheme {
-	case "http", "https":
-	case "ws":
-		upstreamURL.Scheme = "http"
-	case "wss":
-		upstreamURL.Scheme = "https"
+	var rt *runtimeRoute
+	var err error
+	switch {
+	case r.Mock != nil:
+		rt, err = buildMockRoute(project, r, env, strip)
+	case r.Root != "":
+		rt, err = buildStaticRoute(project, r, env, strip)
+	case r.Replay != "":
+		rt, err = buildReplayRoute(project, r, env, strip)
+	case len(r.Targets()) == 0:
+		return nil, fmt.Errorf("route %s has no upstream", r.Path)
 	default:
-		return nil, fmt.Errorf("unsupported scheme %s", upstreamURL.Scheme)
+		rt, err = buildProxyRoute(project, r, env, strip)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rt.websocket = r.Websocket
+	if r.Retry != nil {
+		rt.retryTimeout = r.Retry.Timeout.Std()
 	}
+	if r.HealthCheck != nil {
+		rt.healthTimeout = r.HealthCheck.Timeout.Std()
+	}
+	return rt, nil
+}
 
-	strip := true
-	if r.StripPathPrefix != nil {
-		strip = *r.StripPathPrefix
+func buildStaticRoute(project string, r *config.Route, env buildEnv, strip bool) (*runtimeRoute, error) {
+	if len(r.Targets()) > 0 {
+		return nil, fmt.Errorf("route %s cannot have both a root and an upstream", r.Path)
 	}
+	return &runtimeRoute{
+		project:     project,
+		path:        r.Path,
+		kind:        "static",
+		stripPrefix: strip,
+		spaFallback: r.SpaFallback,
+		handler:     newStaticHandler(r, env.baseDir, strip),
+	}, nil
+}
 
+// buildMockRoute serves the route's mock responses, falling back to its
+// upstream when one is configured.
+func buildMockRoute(project string, r *config.Route, env buildEnv, strip bool) (*runtimeRoute, error) {
+	if r.Root != "" {
+		return nil, fmt.Errorf("route %s cannot have both a root and a mock", r.Path)
+	}
+	rt := &runtimeRoute{
+		project:     project,
+		path:        r.Path,
+		stripPrefix: strip,
+		spaFallback: r.SpaFallback,
+	}
+	var next http.Handler
+	if len(r.Targets()) > 0 {
+		proxied, err := buildProxyRoute(project, r, env, strip)
+		if err != nil {
+			return nil, err
+		}
+		rt = proxied
+		next = http.HandlerFunc(rt.serveProxy)
+	}
+	handler, err := newMockHandler(r, env.baseDir, strip, next)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", r.Path, err)
+	}
+	rt.kind = "mock"
+	rt.handler = handler
+	return rt, nil
+}
+
+// buildReplayRoute serves the responses recorded in a HAR file. The
+// recordings hold upstream paths, so the route prefix is stripped first.
+func buildReplayRoute(project string, r *config.Route, env buildEnv, strip bool) (*runtimeRoute, error) {
+	if len(r.Targets()) > 0 {
+		return nil, fmt.Errorf("route %s cannot have both a replay file and an upstream", r.Path)
+	}
+	name := r.Replay
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(env.baseDir, name)
+	}
+	archive, err := har.Load(name)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", r.Path, err)
+	}
+	replayer := har.NewReplayer(archive)
+	prefix := r.Path
+	return &runtimeRoute{
+		project:     project,
+		path:        r.Path,
+		kind:        "replay",
+		stripPrefix: strip,
+		spaFallback: r.SpaFallback,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rewritePath(req, prefix, strip)
+			replayer.ServeHTTP(w, req)
+		}),
+	}, nil
+}
+
+func buildProxyRoute(project string, r *config.Route, env buildEnv, strip bool) (*runtimeRoute, error) {
+	upstreams := r.Targets()
+	targets := make([]*upstreamTarget, 0, len(upstreams))
+	for _, raw := range upstreams {
+		upstreamURL, socket, err := parseUpstream(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream for path %s: %w", r.Path, err)
+		}
+		target := newUpstreamTarget(raw, upstreamURL, socket)
+		target.proxy = newUpstreamProxy(project, target, r, strip, env)
+		targets = append(targets, target)
+	}
+	lb, err := newBalancer(r.LoadBalancing, r.Path, targets)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", r.Path, err)
+	}
+
+	return &runtimeRoute{
+		project:     project,
+		path:        r.Path,
+		kind:        "proxy",
+		stripPrefix: strip,
+		spaFallback: r.SpaFallback,
+		balancer:    lb,
+		health:      newHealthChecker(project, r.Path, r.HealthCheck),
+		ready:       env.ready,
+		metrics:     env.metrics,
+	}, nil
+}
+
+func newUpstreamProxy(project string, target *upstreamTarget, r *config.Route, strip bool, env buildEnv) *httputil.ReverseProxy {
+	upstreamURL := target.url
+	pathPrefix := r.Path
 	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	var transport http.RoundTripper = timingTransport{base: target.transport}
+	if env.metrics != nil {
+		transport = metricsTransport{base: transport, metrics: env.metrics, project: project, route: pathPrefix, upstream: target.raw}
+	}
+	transport = newRetryTransport(transport, r.Retry)
+	if env.tracer != nil {
+		transport = tracingTransport{base: transport, tracer: env.tracer, project: project, route: pathPrefix, upstream: target.raw}
+	}
+	proxy.Transport = newCaptureTransport(transport, env.observer, project, pathPrefix, target.raw)
 	originalDirector := proxy.Director
-	pathPrefix := r.Path
 	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
+		if target.socket != "" {
+			// Socket upstreams carry their base path after the socket, so
+			// strip the route prefix before that base path is joined.
+			rewritePath(req, pathPrefix, strip)
+			originalDirector(req)
+		} else {
+			originalDirector(req)
+			rewritePath(req, pathPrefix, strip)
+		}
 		req.Header.Set("X-Forwarded-Proto", "https")
 		originalHost := req.Header.Get("X-Original-Host")
 		if originalHost == "" {
@@ -335,20 +789,26 @@ func buildRuntimeRoute(r *config.Route) (*runtimeRoute, error) {
 		}
 		req.Header.Set("X-Forwarded-Host", originalHost)
 		req.Host = upstreamURL.Host
-		rewritePath(req, pathPrefix, strip)
+		if hc := headerContextFrom(req.Context()); hc != nil {
+			applyHeaderRules(hc.rules.request, req.Header, hc.data)
+		}
+		if info := requestInfoFrom(req.Context()); info != nil {
+			info.RewrittenPath = req.URL.Path
+			info.Upstream = target.raw
+		}
 	}
 	proxy.ModifyResponse = sanitizeResponseCookies
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		log.Printf("proxy error for %s via %s: %v", r.URL.Path, upstreamURL, err)
-		http.Error(w, "upstream error", http.StatusBadGateway)
+		writeUpstreamError(w, r, http.StatusBadGateway, upstreamError{
+			Error:    "upstream error",
+			Project:  project,
+			Route:    pathPrefix,
+			Upstream: target.raw,
+			Detail:   err.Error(),
+		})
 	}
-
-	return &runtimeRoute{
-		path:        pathPrefix,
-		stripPrefix: strip,
-		spaFallback: r.SpaFallback,
-		proxy:       proxy,
-	}, nil
+	return proxy
 }
 
 func (rt *runtimeRoute) matches(path string) bool {
@@ -372,8 +832,146 @@ func (rt *runtimeRoute) serveHTTP(w http.ResponseWriter, r *http.Request, fallba
 		r.URL.Path = "/"
 		r.URL.RawPath = ""
 	}
+	path := r.URL.Path
+	if fallback {
+		path = r.Header.Get("X-Devlink-Original-Path")
+	}
 	r.Header.Set("X-Original-Host", hostOnly(r.Host))
-	rt.proxy.ServeHTTP(w, r)
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.Project = rt.project
+		info.Route = rt.path
+		info.Fallback = fallback
+	}
+	if rt.headers != nil {
+		data := newHeaderData(r, rt, path)
+		if len(rt.headers.response) > 0 {
+			w = &headerWriter{ResponseWriter: w, rules: rt.headers.response, data: data}
+		}
+		if rt.handler != nil {
+			applyHeaderRules(rt.headers.request, r.Header, data)
+		} else {
+			// The proxy applies request rules after setting its own headers.
+			r = r.WithContext(withHeaderContext(r.Context(), &headerContext{rules: rt.headers, data: data}))
+		}
+	}
+	if rt.handler != nil {
+		rt.handler.ServeHTTP(w, r)
+		return
+	}
+	rt.serveProxy(w, r)
+}
+
+// serveProxy forwards the request to one of the route's upstream targets.
+func (rt *runtimeRoute) serveProxy(w http.ResponseWriter, r *http.Request) {
+	if !rt.isReady() {
+		writeUpstreamError(w, r, http.StatusServiceUnavailable, upstreamError{
+			Error:    "upstream starting",
+			Project:  rt.project,
+			Route:    rt.path,
+			Upstream: strings.Join(rt.upstreams(), ", "),
+			Detail:   "waiting for the process readiness probe to pass",
+		})
+		return
+	}
+	target := rt.balancer.pick(w, r)
+	if target == nil {
+		log.Printf("no healthy upstream for %s%s", rt.project, rt.path)
+		writeUpstreamError(w, r, http.StatusServiceUnavailable, upstreamError{
+			Error:    "no healthy upstream",
+			Project:  rt.project,
+			Route:    rt.path,
+			Upstream: strings.Join(rt.upstreams(), ", "),
+			Detail:   "every upstream is failing its health check",
+		})
+		return
+	}
+	atomic.AddInt64(&target.active, 1)
+	defer atomic.AddInt64(&target.active, -1)
+	if isWebsocketUpgrade(r) {
+		// The proxy blocks while the upgraded connection is open.
+		defer rt.metrics.trackWebsocket(rt.project, rt.path)()
+	}
+	target.proxy.ServeHTTP(w, r)
+}
+
+// isReady reports whether the route's supervised process, if any, passed its
+// readiness probe.
+func (rt *runtimeRoute) isReady() bool {
+	return rt.ready == nil || rt.ready(rt.project, rt.path)
+}
+
+// targets returns the upstream targets of proxied routes.
+func (rt *runtimeRoute) targets() []*upstreamTarget {
+	if rt.balancer == nil {
+		return nil
+	}
+	return rt.balancer.targets
+}
+
+func (rt *runtimeRoute) upstreams() []string {
+	upstreams := make([]string, 0, len(rt.targets()))
+	for _, t := range rt.targets() {
+		upstreams = append(upstreams, t.raw)
+	}
+	return upstreams
+}
+
+// startHealthChecks launches the health checkers of every route in routers.
+// They stop when ctx is cancelled.
+func startHealthChecks(ctx context.Context, routers map[string]*domainRouter) {
+	seen := map[*domainRouter]bool{}
+	for _, dr := range routers {
+		if seen[dr] {
+			continue
+		}
+		seen[dr] = true
+		for _, rt := range dr.routes {
+			if rt.health == nil {
+				continue
+			}
+			for _, target := range rt.targets() {
+				go rt.health.run(ctx, target)
+			}
+		}
+	}
+}
+
+// UpstreamHealth returns the health of every upstream target currently
+// loaded, ordered by project, route and upstream.
+func (s *Server) UpstreamHealth() []admin.UpstreamStatus {
+	s.mu.RLock()
+	routers := s.routers
+	s.mu.RUnlock()
+	seen := map[*domainRouter]bool{}
+	var statuses []admin.UpstreamStatus
+	for _, dr := range routers {
+		if seen[dr] {
+			continue
+		}
+		seen[dr] = true
+		for _, rt := range dr.routes {
+			for _, target := range rt.targets() {
+				statuses = append(statuses, admin.UpstreamStatus{
+					Project:  rt.project,
+					Route:    rt.path,
+					Upstream: target.raw,
+					Healthy:  target.healthy.Load(),
+					Active:   atomic.LoadInt64(&target.active),
+				})
+			}
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Upstream < b.Upstream
+	})
+	return statuses
 }
 
 func rewritePath(req *http.Request, prefix string, strip bool) {
@@ -396,6 +994,11 @@ func rewritePath(req *http.Request, prefix string, strip bool) {
 	}
 }
 
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
 func acceptsHTML(r *http.Request) bool {
 	accept := r.Header.Get("Accept")
 	return strings.Contains(accept, "text/html") || accept == ""
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"local-ssl/internal/config"
+)
+
+var defaultIndexFiles = []string{"index.html"}
+
+// precompressed lists the encodings served from sibling files, in order of
+// preference.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandler serves files below a root directory.
+type staticHandler struct {
+	root   string
+	prefix string
+	strip  bool
+	index  []string
+	browse bool
+	spa    bool
+}
+
+func newStaticHandler(r *config.Route, baseDir string, strip bool) *staticHandler {
+	root := r.Root
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(baseDir, root)
+	}
+	index := r.Index
+	if len(index) == 0 {
+		index = defaultIndexFiles
+	}
+	return &staticHandler{
+		root:   root,
+		prefix: r.Path,
+		strip:  strip,
+		index:  index,
+		browse: r.Browse,
+		spa:    r.SpaFallback,
+	}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	urlPath := r.URL.Path
+	if h.strip && h.prefix != "/" {
+		urlPath = strings.TrimPrefix(urlPath, strings.TrimSuffix(h.prefix, "/"))
+	}
+	urlPath = path.Clean("/" + urlPath)
+	name := filepath.Join(h.root, filepath.FromSlash(urlPath))
+
+	info, err := os.Stat(name)
+	if err != nil {
+		h.notFound(w, r, err)
+		return
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		for _, index := range h.index {
+			indexName := filepath.Join(name, index)
+			if indexInfo, err := os.Stat(indexName); err == nil && !indexInfo.IsDir() {
+				h.serveFile(w, r, indexName, indexInfo)
+				return
+			}
+		}
+		if h.browse {
+			h.serveListing(w, r, name)
+			return
+		}
+		h.notFound(w, r, fs.ErrNotExist)
+		return
+	}
+	h.serveFile(w, r, name, info)
+}
+
+// notFound applies the SPA fallback semantics of proxied frontends: HTML
+// navigations to unknown paths receive the root index document.
+func (h *staticHandler) notFound(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("static %s: %v", r.URL.Path, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if h.spa && acceptsHTML(r) {
+		for _, index := range h.index {
+			name := filepath.Join(h.root, index)
+			if info, err := os.Stat(name); err == nil && !info.IsDir() {
+				h.serveFile(w, r, name, info)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// serveFile writes name, preferring a precompressed variant the client
+// accepts. http.ServeContent handles conditional and range requests.
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, info os.FileInfo) {
+	ctype := mime.TypeByExtension(filepath.Ext(name))
+	served, servedInfo, encoding := name, info, ""
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, variant := range precompressed {
+		if !acceptsEncoding(accepted, variant.encoding) {
+			continue
+		}
+		if vInfo, err := os.Stat(name + variant.ext); err == nil && !vInfo.IsDir() {
+			served, servedInfo, encoding = name+variant.ext, vInfo, variant.encoding
+			break
+		}
+	}
+
+	f, err := os.Open(served)
+	if err != nil {
+		h.notFound(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("ETag", fmt.Sprintf(`"%x-%x%s"`, servedInfo.ModTime().UnixNano(), servedInfo.Size(), encoding))
+	if ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		if ctype == "" {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+	}
+	http.ServeContent(w, r, filepath.Base(name), servedInfo.ModTime(), f)
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title>
+<style>body{font:14px/1.6 system-ui,sans-serif;margin:2em}a{text-decoration:none}td{padding:0 1.5em 0 0}</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td>{{.Size}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type listingEntry struct {
+	Name string
+	Href string
+	Size string
+}
+
+func (h *staticHandler) serveListing(w http.ResponseWriter, r *http.Request, dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		h.notFound(w, r, err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+	data := struct {
+		Path    string
+		Entries []listingEntry
+	}{Path: r.URL.Path}
+	for _, entry := range entries {
+		e := listingEntry{Name: entry.Name(), Href: (&url.URL{Path: entry.Name()}).String()}
+		if entry.IsDir() {
+			e.Name += "/"
+			e.Href += "/"
+		} else if info, err := entry.Info(); err == nil {
+			e.Size = fmt.Sprintf("%d", info.Size())
+		}
+		data.Entries = append(data.Entries, e)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := listingTemplate.Execute(w, data); err != nil {
+		log.Printf("render listing: %v", err)
+	}
+}
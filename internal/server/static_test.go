@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func newStaticTestRoute(t *testing.T, route *config.Route) *runtimeRoute {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"dist/index.html":        "<h1>app</h1>",
+		"dist/app.js":            "console.log('plain')",
+		"dist/app.js.gz":         "gzipped",
+		"dist/assets/logo.svg":   "<svg/>",
+		"dist/docs/readme.txt":   "0123456789",
+		"dist/docs/sub/note.txt": "note",
+	})
+	rt, err := buildRuntimeRoute("demo", route, buildEnv{baseDir: dir})
+	if err != nil {
+		t.Fatalf("buildRuntimeRoute returned error: %v", err)
+	}
+	return rt
+}
+
+func TestStaticServesIndexAndMIMETypes(t *testing.T) {
+	rt := newStaticTestRoute(t, &config.Route{Path: "/", Root: "dist"})
+
+	rec, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/", nil))
+	if rec.Code != http.StatusOK || body != "<h1>app</h1>" {
+		t.Fatalf("expected index document, got %d %q", rec.Code, body)
+	}
+	rec, _ = serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/assets/logo.svg", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Fatal("expected an ETag header")
+	}
+}
+
+func TestStaticPrecompressedAndRange(t *testing.T) {
+	rt := newStaticTestRoute(t, &config.Route{Path: "/", Root: "dist"})
+
+	req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br;q=0, gzip")
+	rec, body := serveBody(t, rt, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" || body != "gzipped" {
+		t.Fatalf("expected gzip variant, got %q %q", rec.Header().Get("Content-Encoding"), body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Fatalf("expected JavaScript content type, got %q", ct)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "https://demo.localhost/docs/readme.txt", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	rec, body = serveBody(t, rt, req)
+	if rec.Code != http.StatusPartialContent || body != "234" {
+		t.Fatalf("expected partial content, got %d %q", rec.Code, body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "https://demo.localhost/docs/readme.txt", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	if rec, _ = serveBody(t, rt, req); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching ETag, got %d", rec.Code)
+	}
+}
+
+func TestStaticSPAFallback(t *testing.T) {
+	rt := newStaticTestRoute(t, &config.Route{Path: "/", Root: "dist", SpaFallback: true})
+
+	req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/settings/profile", nil)
+	req.Header.Set("Accept", "text/html")
+	if rec, body := serveBody(t, rt, req); rec.Code != http.StatusOK || body != "<h1>app</h1>" {
+		t.Fatalf("expected SPA index, got %d %q", rec.Code, body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "https://demo.localhost/missing.js", nil)
+	req.Header.Set("Accept", "*/*")
+	if rec, _ := serveBody(t, rt, req); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for missing asset, got %d", rec.Code)
+	}
+}
+
+func TestStaticDirectoryListing(t *testing.T) {
+	rt := newStaticTestRoute(t, &config.Route{Path: "/files", Root: "dist", Browse: true})
+
+	rec, _ := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/files/docs", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/files/docs/" {
+		t.Fatalf("expected redirect to trailing slash, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/files/docs/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(body, `href="sub/"`) || !strings.Contains(body, `href="readme.txt"`) {
+		t.Fatalf("unexpected listing %d:\n%s", rec.Code, body)
+	}
+
+	rec, _ = serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/files/../../etc/passwd", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected traversal to stay inside root, got %d", rec.Code)
+	}
+}
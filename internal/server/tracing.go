@@ -0,0 +1,393 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"local-ssl/internal/config"
+)
+
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+
+	spanStatusError = 2
+
+	traceBatchSize     = 256
+	traceFlushInterval = 2 * time.Second
+)
+
+// span is a finished or in-flight OpenTelemetry span.
+type span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []spanAttr
+	err      string
+}
+
+type spanAttr struct {
+	key   string
+	value interface{}
+}
+
+func (s *span) set(key string, value interface{}) {
+	s.attrs = append(s.attrs, spanAttr{key, value})
+}
+
+func (s *span) fail(msg string) {
+	s.err = msg
+}
+
+// traceparent renders the W3C trace context header naming s as the parent.
+func (s *span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// parseTraceparent parses a W3C traceparent header into the span it names.
+func parseTraceparent(h string) (*span, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return nil, false
+	}
+	var p span
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, false
+	}
+	if _, err := hex.Decode(p.traceID[:], []byte(parts[1])); err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(p.spanID[:], []byte(parts[2])); err != nil {
+		return nil, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || p.traceID == [16]byte{} || p.spanID == [8]byte{} {
+		return nil, false
+	}
+	p.sampled = flags&1 == 1
+	return &p, true
+}
+
+// tracer records spans and exports them in batches.
+type tracer struct {
+	cfg      config.Tracing
+	endpoint string
+	file     *os.File
+	client   *http.Client
+
+	spans chan *span
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// newTracer builds the tracer described by cfg, or returns nil when tracing
+// is not configured. prev is reused when the configuration did not change.
+func newTracer(cfg *config.Tracing, baseDir string, prev *tracer) (*tracer, error) {
+	if cfg == nil || (cfg.Endpoint == "" && cfg.File == "") {
+		return nil, nil
+	}
+	if prev != nil && reflect.DeepEqual(prev.cfg, *cfg) {
+		return prev, nil
+	}
+	t := &tracer{
+		cfg:    *cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		spans:  make(chan *span, 4*traceBatchSize),
+		done:   make(chan struct{}),
+	}
+	if cfg.Endpoint != "" {
+		if !strings.HasPrefix(cfg.Endpoint, "http://") && !strings.HasPrefix(cfg.Endpoint, "https://") {
+			return nil, fmt.Errorf("tracing: endpoint %q is not an http(s) URL", cfg.Endpoint)
+		}
+		t.endpoint = cfg.Endpoint
+	}
+	if cfg.File != "" {
+		name := cfg.File
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(baseDir, name)
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		t.file = f
+	}
+	t.wg.Add(1)
+	go t.run()
+	return t, nil
+}
+
+// start begins a span. A nil parent starts a new sampled trace.
+func (t *tracer) start(kind int, name string, parent *span) *span {
+	s := &span{tracer: t, name: name, kind: kind, start: time.Now(), sampled: true}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		s.sampled = parent.sampled
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// finish ends s and queues it for export. Spans are dropped when the export
+// queue is full or the tracer was replaced.
+func (s *span) finish() {
+	s.end = time.Now()
+	if !s.sampled {
+		return
+	}
+	select {
+	case <-s.tracer.done:
+	case s.tracer.spans <- s:
+	default:
+	}
+}
+
+// Close flushes queued spans and stops the exporter.
+func (t *tracer) Close() {
+	if t == nil {
+		return
+	}
+	close(t.done)
+	t.wg.Wait()
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+func (t *tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	var batch []*span
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				t.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.export(batch)
+			batch = nil
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *tracer) export(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+	data, err := json.Marshal(t.request(batch))
+	if err != nil {
+		log.Printf("tracing: encode spans: %v", err)
+		return
+	}
+	if t.file != nil {
+		if _, err := t.file.Write(append(data, '\n')); err != nil {
+			log.Printf("tracing: write spans: %v", err)
+		}
+	}
+	if t.endpoint != "" {
+		if err := t.post(data); err != nil {
+			log.Printf("tracing: export %d span(s): %v", len(batch), err)
+		}
+	}
+}
+
+func (t *tracer) post(data []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// OTLP/JSON encoding of an ExportTraceServiceRequest.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func (t *tracer) request(batch []*span) otlpRequest {
+	service := t.cfg.ServiceName
+	if service == "" {
+		service = "devlink"
+	}
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, a := range s.attrs {
+			out.Attributes = append(out.Attributes, newOTLPAttr(a.key, a.value))
+		}
+		if s.err != "" {
+			out.Status = otlpStatus{Code: spanStatusError, Message: s.err}
+		}
+		spans = append(spans, out)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttr{newOTLPAttr("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "devlink"}, Spans: spans}},
+	}}}
+}
+
+func newOTLPAttr(key string, value interface{}) otlpAttr {
+	var v otlpValue
+	switch value := value.(type) {
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttr{Key: key, Value: v}
+}
+
+// tracingTransport wraps upstream calls in client spans and propagates the
+// trace context to the upstream.
+type tracingTransport struct {
+	base                     http.RoundTripper
+	tracer                   *tracer
+	project, route, upstream string
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var parent *span
+	if info := requestInfoFrom(req.Context()); info != nil {
+		parent = info.Span
+	}
+	s := t.tracer.start(spanKindClient, req.Method+" "+t.route, parent)
+	s.set("http.request.method", req.Method)
+	s.set("url.full", req.URL.String())
+	s.set("devlink.project", t.project)
+	s.set("devlink.route", t.route)
+	s.set("devlink.upstream", t.upstream)
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", s.traceparent())
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		s.fail(err.Error())
+	} else {
+		s.set("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			s.fail(resp.Status)
+		}
+	}
+	s.finish()
+	return resp, err
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for h, valid := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00": true,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7":    false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": false,
+		"garbage": false,
+	} {
+		if _, ok := parseTraceparent(h); ok != valid {
+			t.Errorf("parseTraceparent(%q) valid = %v, want %v", h, ok, valid)
+		}
+	}
+}
+
+func TestTracingPropagatesAndExports(t *testing.T) {
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var mu sync.Mutex
+	var exported []otlpSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid OTLP request: %v", err)
+		}
+		mu.Lock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				exported = append(exported, ss.Spans...)
+			}
+		}
+		mu.Unlock()
+	}))
+	t.Cleanup(collector.Close)
+
+	var upstreamParent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get("traceparent")
+	}))
+	t.Cleanup(backend.Close)
+
+	tr, err := newTracer(&config.Tracing{Endpoint: collector.URL}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("newTracer returned error: %v", err)
+	}
+	cfg := &config.Config{Projects: map[string]*config.Project{
+		"demo": {
+			Domains: []string{"demo.localhost"},
+			Routes:  []*config.Route{{Path: "/api", Upstream: backend.URL}},
+		},
+	}}
+	routers, err := buildRouters(cfg, buildEnv{tracer: tr})
+	if err != nil {
+		t.Fatalf("buildRouters returned error: %v", err)
+	}
+	s := &Server{routers: routers, tracer: tr}
+	req := httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/items", nil)
+	req.Header.Set("traceparent", incoming)
+	s.handleHTTPS(httptest.NewRecorder(), req)
+	tr.Close()
+
+	if !strings.HasPrefix(upstreamParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || upstreamParent == incoming {
+		t.Fatalf("expected the trace to continue upstream, got %q", upstreamParent)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exported) != 2 {
+		t.Fatalf("expected two spans, got %d", len(exported))
+	}
+	spans := map[int]otlpSpan{}
+	for _, sp := range exported {
+		spans[sp.Kind] = sp
+	}
+	server, client := spans[spanKindServer], spans[spanKindClient]
+	if server.ParentSpanID != "00f067aa0ba902b7" || server.Name != "GET /api" {
+		t.Fatalf("unexpected server span: %+v", server)
+	}
+	if client.ParentSpanID != server.SpanID || !strings.Contains(upstreamParent, client.SpanID) {
+		t.Fatalf("client span %+v is not a child of server span %s", client, server.SpanID)
+	}
+	var project string
+	for _, a := range server.Attributes {
+		if a.Key == "devlink.project" && a.Value.StringValue != nil {
+			project = *a.Value.StringValue
+		}
+	}
+	if project != "demo" {
+		t.Fatalf("expected the project attribute, got %+v", server.Attributes)
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// parseUpstream parses an upstream URL. WebSocket schemes map to their HTTP
+// equivalents. Unix socket upstreams take the form unix:///path/to.sock with
+// an optional :/base/path suffix; the returned URL then carries a placeholder
+// host and the base path, and socket holds the socket path.
+func parseUpstream(raw string) (u *url.URL, socket string, err error) {
+	upstreamURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	switch upstreamURL.Scheme {
+	case "http", "https":
+	case "ws":
+		upstreamURL.Scheme = "http"
+	case "wss":
+		upstreamURL.Scheme = "https"
+	case "unix":
+		return parseUnixUpstream(upstreamURL)
+	default:
+		return nil, "", fmt.Errorf("unsupported scheme %s", upstreamURL.Scheme)
+	}
+	return upstreamURL, "", nil
+}
+
+func parseUnixUpstream(u *url.URL) (*url.URL, string, error) {
+	if u.Host != "" {
+		return nil, "", fmt.Errorf("unix upstream must use an absolute socket path (unix:///path/to.sock), got host %q", u.Host)
+	}
+	socket, base, _ := strings.Cut(u.Path, ":")
+	if socket == "" {
+		return nil, "", errors.New("unix upstream requires a socket path")
+	}
+	if base != "" && !strings.HasPrefix(base, "/") {
+		return nil, "", fmt.Errorf("unix upstream base path must start with '/' (got %s)", base)
+	}
+	return &url.URL{Scheme: "http", Host: "localhost", Path: base}, socket, nil
+}
+
+// newUpstreamTransport returns the transport used to reach an upstream,
+// dialling the Unix domain socket when one is given.
+func newUpstreamTransport(socket string) http.RoundTripper {
+	if socket == "" {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+	return transport
+}
+
+// reachable reports whether the target accepts connections.
+func (t *upstreamTarget) reachable(r *http.Request) bool {
+	return t.dial(r.Context()) == nil
+}
+
+// dial opens and closes a connection to the target.
+func (t *upstreamTarget) dial(ctx context.Context) error {
+	network, addr := "tcp", t.url.Host
+	if t.socket != "" {
+		network, addr = "unix", t.socket
+	} else if t.url.Port() == "" {
+		port := "80"
+		if t.url.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(t.url.Hostname(), port)
+	}
+	dialer := net.Dialer{Timeout: time.Second}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// CheckUpstream reports whether the upstream accepts connections.
+func CheckUpstream(ctx context.Context, raw string) error {
+	u, socket, err := parseUpstream(raw)
+	if err != nil {
+		return err
+	}
+	return newUpstreamTarget(raw, u, socket).dial(ctx)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"local-ssl/internal/config"
+)
+
+func TestParseUnixUpstream(t *testing.T) {
+	u, socket, err := parseUpstream("unix:///run/app.sock:/base")
+	if err != nil {
+		t.Fatalf("parseUpstream returned error: %v", err)
+	}
+	if socket != "/run/app.sock" || u.Path != "/base" || u.Scheme != "http" {
+		t.Fatalf("unexpected result %v %q", u, socket)
+	}
+	if _, _, err := parseUpstream("unix://relative.sock"); err == nil {
+		t.Fatal("expected error for relative socket path")
+	}
+}
+
+func TestUnixSocketUpstream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets in temp dirs are not reliable on windows")
+	}
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	rt := newTestRoute(t, &config.Route{Path: "/api", Upstream: "unix://" + socket + ":/base"})
+	rec, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost/api/users", nil))
+	if rec.Code != http.StatusOK || body != "/base/users" {
+		t.Fatalf("expected /base/users from socket upstream, got %d %q", rec.Code, body)
+	}
+}
+
+func TestTCPUpstreamBasePathKeepsJoinOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		route *config.Route
+		path  string
+		want  string
+	}{
+		{&config.Route{Path: "/app", Upstream: srv.URL + "/api"}, "/app/users", "/api/app/users"},
+		{&config.Route{Path: "/app", Upstream: srv.URL}, "/app/users", "/users"},
+		{&config.Route{Path: "/", Upstream: srv.URL + "/api"}, "/users", "/api/users"},
+	}
+	for _, tt := range tests {
+		rt := newTestRoute(t, tt.route)
+		rec, body := serveBody(t, rt, httptest.NewRequest(http.MethodGet, "https://demo.localhost"+tt.path, nil))
+		if rec.Code != http.StatusOK || body != tt.want {
+			t.Fatalf("%s via %s: expected %q, got %d %q", tt.path, tt.route.Upstream, tt.want, rec.Code, body)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"local-ssl/internal/config"
+	"local-ssl/internal/ports"
+)
+
+// reloadDebounce coalesces the burst of events a single save produces, so
+// partially written files are not loaded.
+const reloadDebounce = 250 * time.Millisecond
+
+func (s *Server) watchLoop(ctx context.Context) {
+	defer s.watcher.Close()
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod || !s.relevant(event.Name) {
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+		case <-debounce.C:
+			s.reloadIfChanged()
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watch error: %v", err)
+		}
+	}
+}
+
+// relevant reports whether a change to the named file may affect the
+// configuration: the configuration file, an included project file, or a
+// file an include entry may match.
+func (s *Server) relevant(name string) bool {
+	s.mu.RLock()
+	snap := s.snapshot
+	s.mu.RUnlock()
+	if filepath.Clean(name) == filepath.Clean(ports.Path(s.opts.StateDir)) {
+		return true
+	}
+	if snap == nil {
+		return filepath.Clean(name) == filepath.Clean(s.opts.ConfigPath)
+	}
+	return snap.Relevant(name)
+}
+
+// digest fingerprints the configuration files of snap together with the
+// port assignments, which auto-port upstreams depend on.
+func (s *Server) digest(snap *config.Snapshot) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(snap.Digest[:])
+	if data, err := os.ReadFile(ports.Path(s.opts.StateDir)); err == nil {
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// reloadIfChanged reloads the configuration unless the content of its files
+// matches what was last applied. A failed reload keeps the current routing
+// table and is retried on the next event.
+func (s *Server) reloadIfChanged() {
+	if _, err := os.Stat(s.opts.ConfigPath); errors.Is(err, os.ErrNotExist) {
+		// Removed, possibly in the middle of a save; wait for it to return.
+		log.Printf("config %s was removed; keeping the current configuration", s.opts.ConfigPath)
+		return
+	}
+	snap, _ := config.Read(s.opts.ConfigPath)
+	s.mu.RLock()
+	// After a failed reload every event retries, whatever the files hold.
+	unchanged := s.digest(snap) == s.configHash && s.lastReload.Error == ""
+	s.mu.RUnlock()
+	if unchanged {
+		return
+	}
+	if err := s.reload(); err != nil {
+		log.Printf("reload error: %v; keeping the last good configuration", err)
+	}
+}
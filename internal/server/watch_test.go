@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"local-ssl/internal/config"
+	"local-ssl/internal/ports"
+)
+
+func writeConfigAtomically(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func projectConfig(domain string) string {
+	return "projects:\n  demo:\n    domains: [" + domain + "]\n    routes:\n      - path: /\n        upstream: http://127.0.0.1:1\n"
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWatchReloadsAtomicSavesAndKeepsLastGood(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	if err := os.WriteFile(path, []byte(projectConfig("one.localhost")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{opts: Options{ConfigPath: path, StateDir: dir}, watcher: watcher, control: newControlState()}
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchLoop(ctx)
+
+	writeConfigAtomically(t, path, projectConfig("two.localhost"))
+	waitFor(t, "the renamed config to load", func() bool { return s.lookupRouter("two.localhost") != nil })
+
+	if err := os.WriteFile(path, []byte("projects: [broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reload error", func() bool { return s.Status().LastReload.Error != "" })
+	if s.lookupRouter("two.localhost") == nil {
+		t.Fatal("expected the last good routing table to stay active")
+	}
+
+	writeConfigAtomically(t, path, projectConfig("two.localhost"))
+	waitFor(t, "the fixed config to load", func() bool { return s.Status().LastReload.Error == "" })
+	loaded := s.Status().LastReload.Time
+
+	writeConfigAtomically(t, path, projectConfig("two.localhost"))
+	time.Sleep(4 * reloadDebounce)
+	if got := s.Status().LastReload.Time; !got.Equal(loaded) {
+		t.Fatal("expected an unchanged config not to be reloaded")
+	}
+}
+
+func TestWatchReloadsIncludedProjectFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	if err := os.WriteFile(path, []byte("include: [repos/*]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "repos"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{opts: Options{ConfigPath: path, StateDir: dir}, watcher: watcher, control: newControlState()}
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchLoop(ctx)
+
+	repo := filepath.Join(dir, "repos", "web")
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	projectFile := filepath.Join(repo, ".devlink.yaml")
+	writeConfigAtomically(t, projectFile, projectConfig("web.localhost"))
+	waitFor(t, "the new project file to load", func() bool { return s.lookupRouter("web.localhost") != nil })
+	if got := s.Routes()[0].Source; got != projectFile {
+		t.Fatalf("expected the route source %s, got %s", projectFile, got)
+	}
+
+	writeConfigAtomically(t, projectFile, projectConfig("web2.localhost"))
+	waitFor(t, "the changed project file to load", func() bool { return s.lookupRouter("web2.localhost") != nil })
+}
+
+func TestReloadValidatesConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	content := projectConfig("one.localhost") +
+		"  other:\n    domains: [ONE.localhost]\n    routes:\n      - path: /\n        upstream: http://127.0.0.1:2\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{opts: Options{ConfigPath: path, StateDir: dir}, control: newControlState()}
+	err := s.reload()
+	if err == nil || !strings.Contains(err.Error(), "domain ONE.localhost is also used by project demo") {
+		t.Fatalf("expected the duplicate domain to be reported, got %v", err)
+	}
+	if s.lookupRouter("one.localhost") != nil {
+		t.Fatal("expected the invalid configuration not to be applied")
+	}
+}
+
+func TestWatchReloadsWhenPortAssignmentsChange(t *testing.T) {
+	dir := t.TempDir()
+	stateDir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	content := "projects:\n  web:\n    domains: [web.localhost]\n    routes:\n      - path: /\n        command:\n          cmd: npm run dev\n          autoPort: true\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{opts: Options{ConfigPath: path, StateDir: stateDir}, watcher: watcher, control: newControlState()}
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchLoop(ctx)
+	before := s.Routes()[0].Upstreams[0]
+
+	// A devlink up elsewhere finds the port taken and moves the project.
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(before, "http://"))
+	ln, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	snap, err := config.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := ports.Open(stateDir)
+	defer store.Release("web")
+	moved, err := ports.Apply(snap.Config, store, "web")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	after := moved.Projects["web"].Routes[0].Upstream
+	if after == before {
+		t.Fatal("expected a new port")
+	}
+	waitFor(t, "the new port to be routed", func() bool { return s.Routes()[0].Upstreams[0] == after })
+}
+
+func TestReloadRetriesAfterTransientFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devlink.yaml")
+	content := "logging:\n  output: file\n  file: logs/access.log\n" + projectConfig("one.localhost")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A file where the log directory belongs makes opening the log fail.
+	blocker := filepath.Join(dir, "logs")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{opts: Options{ConfigPath: path, StateDir: dir}, control: newControlState()}
+	if err := s.reload(); err == nil {
+		t.Fatal("expected the blocked log directory to fail the reload")
+	}
+	if s.lookupRouter("one.localhost") != nil {
+		t.Fatal("expected the failed reload not to be applied")
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	s.reloadIfChanged()
+	if s.lookupRouter("one.localhost") == nil {
+		t.Fatalf("expected the unchanged config to load once the failure cleared, got %q", s.Status().LastReload.Error)
+	}
+	s.mu.RLock()
+	accessLog := s.accessLog
+	s.mu.RUnlock()
+	accessLog.Close()
+}
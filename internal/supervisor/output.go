@@ -0,0 +1,49 @@
+package supervisor
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// lineWriter multiplexes the output of several processes onto one writer
+// without interleaving partial lines.
+type lineWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func newLineWriter(out io.Writer) *lineWriter {
+	return &lineWriter{out: out}
+}
+
+func (w *lineWriter) prefixed(prefix string) io.Writer {
+	return &prefixWriter{parent: w, prefix: []byte(prefix)}
+}
+
+// prefixWriter buffers partial lines and writes complete lines with a
+// prefix. Output not terminated by a newline is held until one arrives.
+type prefixWriter struct {
+	parent *lineWriter
+	prefix []byte
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		idx := bytes.IndexByte(p.buf, '\n')
+		if idx == -1 {
+			break
+		}
+		line := p.buf[:idx+1]
+		p.parent.mu.Lock()
+		_, err := p.parent.out.Write(append(append([]byte{}, p.prefix...), line...))
+		p.parent.mu.Unlock()
+		p.buf = p.buf[idx+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package supervisor
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+func configureProcess(cmd *exec.Cmd) {}
+
+// interruptProcess terminates the process tree; Windows has no SIGINT
+// equivalent for console-less children.
+func interruptProcess(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -0,0 +1,115 @@
+package supervisor
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"local-ssl/internal/config"
+)
+
+// FromConfig builds process specs for every route with a command in the
+// named projects. Relative working directories are resolved against the
+// directory of the project's source file, falling back to baseDir, usually
+// the directory of the configuration file. Auto-port routes must already
+// carry their assigned upstream (see ports.Apply).
+func FromConfig(cfg *config.Config, baseDir string, projects []string) ([]Spec, error) {
+	var specs []Spec
+	for _, name := range projects {
+		proj, ok := cfg.Projects[name]
+		if !ok {
+			return nil, fmt.Errorf("project %s not found", name)
+		}
+		for _, route := range proj.Routes {
+			if route.Command == nil {
+				continue
+			}
+			spec, err := specFromRoute(name, route, proj.Dir(baseDir))
+			if err != nil {
+				return nil, fmt.Errorf("project %s route %s: %w", name, route.Path, err)
+			}
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+func specFromRoute(project string, route *config.Route, baseDir string) (Spec, error) {
+	c := route.Command
+	if c.Cmd == "" {
+		return Spec{}, fmt.Errorf("command is empty")
+	}
+	spec := Spec{
+		Project: project,
+		Route:   route.Path,
+		Command: c.Cmd,
+		Dir:     c.Cwd,
+	}
+	if spec.Dir != "" && !filepath.IsAbs(spec.Dir) {
+		spec.Dir = filepath.Join(baseDir, spec.Dir)
+	}
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		spec.Env = append(spec.Env, k+"="+c.Env[k])
+	}
+
+	network, addr, err := upstreamAddr(route)
+	if err != nil {
+		return Spec{}, err
+	}
+	if c.Ready != nil {
+		if c.Ready.Port != 0 {
+			network, addr = "tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(c.Ready.Port))
+		}
+		if c.Ready.Path != "" && network == "tcp" {
+			spec.ReadyURL = "http://" + addr + c.Ready.Path
+		}
+		spec.ReadyInterval = c.Ready.Interval.Std()
+	}
+	spec.ReadyNetwork, spec.ReadyAddr = network, addr
+	if c.AutoPort {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return Spec{}, err
+		}
+		env := c.PortEnv
+		if env == "" {
+			env = config.DefaultPortEnv
+		}
+		spec.Env = append(spec.Env, env+"="+port)
+	}
+	return spec, nil
+}
+
+// upstreamAddr returns the dial address of the route's first upstream: a
+// host:port, or the socket path of unix:// upstreams.
+func upstreamAddr(route *config.Route) (network, addr string, err error) {
+	targets := route.Targets()
+	if len(targets) == 0 {
+		return "tcp", "", nil
+	}
+	u, err := url.Parse(targets[0])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid upstream %s: %w", targets[0], err)
+	}
+	if u.Scheme == "unix" {
+		socket, _, _ := strings.Cut(u.Path, ":")
+		return "unix", socket, nil
+	}
+	if u.Port() != "" {
+		return "tcp", u.Host, nil
+	}
+	port := "80"
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		port = "443"
+	}
+	return "tcp", net.JoinHostPort(u.Hostname(), port), nil
+}
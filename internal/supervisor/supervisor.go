@@ -0,0 +1,230 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultReadyInterval = 500 * time.Millisecond
+	defaultStopTimeout   = 10 * time.Second
+	minBackoff           = time.Second
+	maxBackoff           = 30 * time.Second
+	// stableAfter resets the restart backoff once a process stays up this
+	// long.
+	stableAfter = 10 * time.Second
+)
+
+// Spec describes a single supervised process.
+type Spec struct {
+	Project string
+	Route   string
+	Command string
+	Dir     string
+	// Env is appended to the environment of the supervisor.
+	Env []string
+	// ReadyAddr is dialled to decide readiness, over ReadyNetwork ("tcp" by
+	// default, or "unix").
+	ReadyNetwork string
+	ReadyAddr    string
+	// ReadyURL, when set, replaces the dial probe with an HTTP GET.
+	ReadyURL      string
+	ReadyInterval time.Duration
+}
+
+// Name identifies the process in logs.
+func (s Spec) Name() string {
+	return s.Project + ":" + s.Route
+}
+
+// Supervisor starts a set of processes, restarts them when they exit and
+// tracks their readiness.
+type Supervisor struct {
+	procs       []*process
+	out         *lineWriter
+	stopTimeout time.Duration
+}
+
+type process struct {
+	spec  Spec
+	ready atomic.Bool
+}
+
+// New creates a supervisor writing prefixed process output to out.
+func New(specs []Spec, out io.Writer) *Supervisor {
+	s := &Supervisor{out: newLineWriter(out), stopTimeout: defaultStopTimeout}
+	for _, spec := range specs {
+		if spec.ReadyInterval <= 0 {
+			spec.ReadyInterval = defaultReadyInterval
+		}
+		s.procs = append(s.procs, &process{spec: spec})
+	}
+	return s
+}
+
+// Ready reports whether the process serving the route has passed its
+// readiness probe. Routes without a supervised process are always ready.
+func (s *Supervisor) Ready(project, route string) bool {
+	for _, p := range s.procs {
+		if p.spec.Project == project && p.spec.Route == route {
+			return p.ready.Load()
+		}
+	}
+	return true
+}
+
+// Run starts every process and keeps them running until ctx is cancelled,
+// then stops them gracefully.
+func (s *Supervisor) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, p := range s.procs {
+		wg.Add(1)
+		go func(p *process) {
+			defer wg.Done()
+			s.supervise(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Supervisor) supervise(ctx context.Context, p *process) {
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx, p)
+		if ctx.Err() != nil {
+			s.logf(p, "stopped")
+			return
+		}
+		if time.Since(started) > stableAfter {
+			backoff = minBackoff
+		}
+		s.logf(p, "exited (%v), restarting in %s", exitReason(err), backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (s *Supervisor) runOnce(ctx context.Context, p *process) error {
+	cmd := shellCommand(p.spec.Command)
+	cmd.Dir = p.spec.Dir
+	cmd.Env = append(os.Environ(), p.spec.Env...)
+	prefix := "[" + p.spec.Name() + "] "
+	cmd.Stdout = s.out.prefixed(prefix)
+	cmd.Stderr = s.out.prefixed(prefix)
+	configureProcess(cmd)
+
+	s.logf(p, "starting: %s", p.spec.Command)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	probeCtx, stopProbe := context.WithCancel(ctx)
+	probeDone := make(chan struct{})
+	go func() {
+		defer close(probeDone)
+		s.probe(probeCtx, p)
+	}()
+	defer func() {
+		stopProbe()
+		<-probeDone
+		p.ready.Store(false)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	s.logf(p, "stopping")
+	if err := interruptProcess(cmd); err != nil {
+		_ = killProcess(cmd)
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(s.stopTimeout):
+		s.logf(p, "did not stop within %s, killing", s.stopTimeout)
+		_ = killProcess(cmd)
+		return <-done
+	}
+}
+
+// probe polls the readiness probe until it passes once.
+func (s *Supervisor) probe(ctx context.Context, p *process) {
+	ticker := time.NewTicker(p.spec.ReadyInterval)
+	defer ticker.Stop()
+	for {
+		if probeOnce(ctx, p.spec) == nil {
+			p.ready.Store(true)
+			s.logf(p, "ready")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func probeOnce(ctx context.Context, spec Spec) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if spec.ReadyURL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec.ReadyURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	if spec.ReadyAddr == "" {
+		return nil
+	}
+	network := spec.ReadyNetwork
+	if network == "" {
+		network = "tcp"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, spec.ReadyAddr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (s *Supervisor) logf(p *process, format string, args ...interface{}) {
+	fmt.Fprintf(s.out.prefixed("[devlink] "), "%s: %s\n", p.spec.Name(), fmt.Sprintf(format, args...))
+}
+
+func exitReason(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
@@ -0,0 +1,99 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisorReadinessAndGracefulStop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	out := &syncBuffer{}
+	sup := New([]Spec{{
+		Project:       "demo",
+		Route:         "/",
+		Command:       "echo hello; sleep 30",
+		ReadyAddr:     ln.Addr().String(),
+		ReadyInterval: 10 * time.Millisecond,
+	}}, out)
+	if !sup.Ready("other", "/") {
+		t.Fatal("unsupervised routes must be ready")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sup.Run(ctx)
+	}()
+	waitFor(t, func() bool { return sup.Ready("demo", "/") })
+	waitFor(t, func() bool { return strings.Contains(out.String(), "[demo:/] hello\n") })
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor did not stop")
+	}
+	if sup.Ready("demo", "/") {
+		t.Fatal("stopped process must not be ready")
+	}
+}
+
+func TestSupervisorRestartsCrashedProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	out := &syncBuffer{}
+	sup := New([]Spec{{Project: "demo", Route: "/api", Command: "echo boot; exit 3"}}, out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sup.Run(ctx)
+
+	waitFor(t, func() bool { return strings.Count(out.String(), "[demo:/api] boot") >= 2 })
+	if !strings.Contains(out.String(), "exit status 3") {
+		t.Fatalf("expected exit status in log, got:\n%s", out.String())
+	}
+}